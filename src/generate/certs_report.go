@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"generator"
+	"models"
+)
+
+func certsReport(arguments []string) {
+	flags := flag.NewFlagSet("generate certs-report", flag.ContinueOnError)
+	sourceFlags := addSourceFlags(flags)
+	format := flags.String("format", "table", "(optional) Output format (table, json)")
+	days := flags.Int("days", 30, "(optional) Exit with a non-zero code when a certificate expires within this many days")
+
+	parseFlags(flags, arguments)
+	if !sourceFlags.given() || (*format != "table" && *format != "json") {
+		fmt.Fprintf(os.Stderr, "Usage of generate certs-report:\n")
+		flags.PrintDefaults()
+		os.Exit(generator.ExitCodeUsage)
+	}
+
+	client, err := sourceFlags.httpClient()
+	FailOnError(err)
+	source, err := sourceFlags.source(client)
+	FailOnError(err)
+	options, err := sourceFlags.options(client)
+	FailOnError(err)
+
+	manifest, err := generator.LoadManifest(context.Background(), source, options)
+	FailOnError(err)
+	report, err := generator.CertificateReport(manifest, time.Now())
+	FailOnError(err)
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		FailOnError(encoder.Encode(report))
+	} else {
+		printCertificateTable(report)
+	}
+
+	expiring := []string{}
+	for _, cert := range report {
+		if cert.DaysUntilExpiry < *days {
+			expiring = append(expiring, cert.Property)
+		}
+	}
+	if len(expiring) > 0 {
+		FailOnError(&generator.ExpiringCertificatesError{Days: *days, Properties: expiring})
+	}
+}
+
+func printCertificateTable(report []models.CertificateInfo) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PROPERTY\tSUBJECT\tSANS\tISSUER\tEXPIRES\tDAYS")
+	for _, cert := range report {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\n",
+			cert.Property,
+			cert.Subject,
+			strings.Join(cert.SANs, ","),
+			cert.Issuer,
+			cert.NotAfter.Format("2006-01-02"),
+			cert.DaysUntilExpiry,
+		)
+	}
+	w.Flush()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"generator"
+)
+
+func decrypt(arguments []string) {
+	flags := flag.NewFlagSet("generate decrypt", flag.ContinueOnError)
+	in := flags.String("in", "", "Encrypted bundle written with -encryptRecipient or -encryptPassphraseFile")
+	out := flags.String("out", "", "Zip file to write the decrypted bundle to")
+	identity := flags.String("identity", "", "Private key file written by generate keygen")
+	passphraseFile := flags.String("passphraseFile", "", "File containing the passphrase the bundle was encrypted with")
+
+	parseFlags(flags, arguments)
+	if *in == "" || *out == "" || (*identity == "") == (*passphraseFile == "") {
+		fmt.Fprintf(os.Stderr, "Usage of generate decrypt:\n")
+		flags.PrintDefaults()
+		os.Exit(generator.ExitCodeUsage)
+	}
+
+	data, err := ioutil.ReadFile(*in)
+	if err != nil {
+		FailOnError(&generator.UsageError{Message: fmt.Sprintf("Could not read encrypted bundle. %s", err)})
+	}
+
+	var decrypted []byte
+	if *identity != "" {
+		key, err := ioutil.ReadFile(*identity)
+		if err != nil {
+			FailOnError(&generator.UsageError{Message: fmt.Sprintf("Could not read private key. %s", err)})
+		}
+		decrypted, err = generator.DecryptWithKey(data, string(key))
+		FailOnError(err)
+	} else {
+		passphrase, err := readPassphrase(*passphraseFile)
+		FailOnError(err)
+		decrypted, err = generator.DecryptWithPassphrase(data, passphrase)
+		FailOnError(err)
+	}
+
+	FailOnError(writeSecretFile(*out, decrypted))
+	fmt.Printf("Decrypted %s to %s\n", *in, *out)
+}
+
+func keygen(arguments []string) {
+	flags := flag.NewFlagSet("generate keygen", flag.ContinueOnError)
+	out := flags.String("out", "", "File to write the private key to, the public key is printed")
+
+	parseFlags(flags, arguments)
+	if *out == "" {
+		fmt.Fprintf(os.Stderr, "Usage of generate keygen:\n")
+		flags.PrintDefaults()
+		os.Exit(generator.ExitCodeUsage)
+	}
+
+	privateKey, publicKey, err := generator.GenerateKeyPair()
+	FailOnError(err)
+	FailOnError(writeSecretFile(*out, []byte(privateKey+"\n")))
+	fmt.Println(publicKey)
+}
+
+// readPassphrase reads a passphrase from filename, without the trailing
+// newline most editors add.
+func readPassphrase(filename string) (string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", &generator.UsageError{Message: fmt.Sprintf("Could not read passphrase file. %s", err)}
+	}
+	passphrase := strings.TrimRight(string(data), "\r\n")
+	if passphrase == "" {
+		return "", &generator.UsageError{Message: "The passphrase file is empty"}
+	}
+	return passphrase, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"generator"
+)
+
+func diff(arguments []string) {
+	flags := flag.NewFlagSet("generate diff", flag.ContinueOnError)
+	sourceFlags := addSourceFlags(flags)
+	oldManifest := flags.String("oldManifest", "", "Path to the manifest to compare with, e.g. saved with bosh manifest before a redeploy")
+	zone := flags.String("zone", "", "(optional) Only compare the cells of this redundancy zone")
+
+	parseFlags(flags, arguments)
+	if !sourceFlags.given() || *oldManifest == "" {
+		fmt.Fprintf(os.Stderr, "Usage of generate diff:\n")
+		flags.PrintDefaults()
+		os.Exit(generator.ExitCodeUsage)
+	}
+
+	client, err := sourceFlags.httpClient()
+	FailOnError(err)
+	source, err := sourceFlags.source(client)
+	FailOnError(err)
+	options, err := sourceFlags.options(client)
+	FailOnError(err)
+	options.Zone = *zone
+
+	previous, err := generator.LoadManifest(context.Background(), generator.FileSource{Path: *oldManifest}, options)
+	FailOnError(err)
+	current, err := generator.LoadManifest(context.Background(), source, options)
+	FailOnError(err)
+
+	diffs, err := generator.DiffManifests(previous, current, options)
+	FailOnError(err)
+	if len(diffs) == 0 {
+		fmt.Println("No changes")
+		return
+	}
+	for _, zone := range diffs {
+		fmt.Printf("Zone %s:\n", zone.Zone)
+		for _, change := range zone.Changes {
+			fmt.Printf("  %s\n", change)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"generator"
+	"models"
+)
+
+// generateInventory fetches the manifest once and writes the scripts of
+// every cell of the inventory into a subdirectory of sink named after the
+// cell. Failed cells are reported and do not stop the others.
+func generateInventory(source generator.Source, options generator.Options, cells []generator.Cell, sink *generator.DirectorySink, msiDir string) {
+	manifest, err := generator.LoadManifest(context.Background(), source, options)
+	FailOnError(err)
+
+	var firstErr error
+	failed := 0
+	for _, cell := range cells {
+		err := generateCell(manifest, options.ForCell(cell), cell, sink, msiDir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "FAILED %s: %s\n", cell.Hostname, err)
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		fmt.Printf("Generated scripts for cell %s in %s\n", cell.Hostname, filepath.Join(sink.Dir, cell.Hostname))
+	}
+
+	fmt.Printf("%d of %d cells generated\n", len(cells)-failed, len(cells))
+	if firstErr != nil {
+		// the exit code tells the kind of the first failure
+		os.Exit(generator.ExitCode(firstErr))
+	}
+}
+
+func generateCell(manifest models.Manifest, options generator.Options, cell generator.Cell, sink *generator.DirectorySink, msiDir string) error {
+	bundle, err := generator.GenerateFromManifest(manifest, options)
+	if err != nil {
+		return err
+	}
+	for _, warning := range bundle.Warnings {
+		fmt.Fprintf(os.Stderr, "WARNING: %s: %s\n", cell.Hostname, warning)
+	}
+	if msiDir != "" {
+		err := bundle.AddMSIs(msiDir)
+		if err != nil {
+			return err
+		}
+	}
+	return bundle.Write(generator.DirectorySink{Dir: filepath.Join(sink.Dir, cell.Hostname)})
+}
@@ -0,0 +1,97 @@
+package generator
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NewBoshHTTPClient returns the client used for all director and UAA
+// requests. The director certificate is verified against the system roots
+// plus caCert, which may either be a path to a PEM file or the PEM itself.
+func NewBoshHTTPClient(caCert string, skipSslValidation bool) (*http.Client, error) {
+	tlsConfig := &tls.Config{}
+
+	if skipSslValidation {
+		tlsConfig.InsecureSkipVerify = true
+	} else if caCert != "" {
+		pool, err := loadCACertPool(caCert)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			TLSClientConfig:     tlsConfig,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+	}, nil
+}
+
+// httpClientOrDefault returns client, or when it is nil a client that
+// verifies certificates against the system roots, so that the HTTPClient
+// fields of the package may be left empty.
+func httpClientOrDefault(client *http.Client) *http.Client {
+	if client != nil {
+		return client
+	}
+	// without a CA certificate to load this cannot fail
+	defaultClient, _ := NewBoshHTTPClient("", false)
+	return defaultClient
+}
+
+func loadCACertPool(caCert string) (*x509.CertPool, error) {
+	pemData := []byte(caCert)
+	if !strings.Contains(caCert, "-----BEGIN") {
+		var err error
+		pemData, err = ioutil.ReadFile(caCert)
+		if err != nil {
+			return nil, &UsageError{fmt.Sprintf("Unable to read CA certificate. %s", err)}
+		}
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, &UsageError{"Unable to parse CA certificate, expected PEM encoded certificates."}
+	}
+	return pool, nil
+}
+
+func NewBoshRequest(client *http.Client, endpoint string, uaa *UAAClient) (*http.Response, error) {
+	return newBoshRequest(context.Background(), client, endpoint, uaa)
+}
+
+func newBoshRequest(ctx context.Context, client *http.Client, endpoint string, uaa *UAAClient) (*http.Response, error) {
+	request, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return nil, &UsageError{fmt.Sprintf("Invalid boshUrl. %s", err)}
+	}
+	request = request.WithContext(ctx)
+
+	if uaa != nil {
+		token, err := uaa.AccessToken()
+		if err != nil {
+			return nil, err
+		}
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response, err := httpClientOrDefault(client).Do(request)
+	if err != nil {
+		return nil, &UnreachableError{Target: "BOSH Director", Err: err}
+	}
+	return response, nil
+}
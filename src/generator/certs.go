@@ -0,0 +1,198 @@
+package generator
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CertificateError is returned when a certificate or key of the manifest is
+// unusable. Path is the manifest property holding it.
+type CertificateError struct {
+	Path string
+	Err  error
+}
+
+func (e *CertificateError) Error() string {
+	return fmt.Sprintf("Invalid manifest property %s: %s", e.Path, e.Err)
+}
+
+func (e *CertificateError) ExitCode() int {
+	return ExitCodeManifest
+}
+
+// certValidation configures how the certificates of a manifest are checked
+// before they are written.
+type certValidation struct {
+	Skip         bool
+	AllowExpired bool
+	Now          time.Time
+}
+
+// keyPair is a certificate, its private key and the CA it must be signed
+// by, together with the manifest properties they were read from.
+type keyPair struct {
+	CA, CAPath     string
+	Cert, CertPath string
+	Key, KeyPath   string
+}
+
+// validate parses the key pair, checks that the key belongs to the
+// certificate and verifies the certificate against the CA. Certificates
+// outside their validity period are errors, or warnings when AllowExpired
+// is set.
+func (v certValidation) validate(pair keyPair) ([]string, error) {
+	if v.Skip {
+		return nil, nil
+	}
+
+	cas, err := parseCertificates(pair.CA)
+	if err != nil {
+		return nil, &CertificateError{Path: pair.CAPath, Err: err}
+	}
+	chain, err := parseCertificates(pair.Cert)
+	if err != nil {
+		return nil, &CertificateError{Path: pair.CertPath, Err: err}
+	}
+	key, err := parsePrivateKey(pair.Key)
+	if err != nil {
+		return nil, &CertificateError{Path: pair.KeyPath, Err: err}
+	}
+
+	cert := chain[0]
+	if !publicKeysEqual(cert.PublicKey, key.Public()) {
+		return nil, &CertificateError{Path: pair.KeyPath, Err: fmt.Errorf("private key does not match the certificate in %s", pair.CertPath)}
+	}
+
+	warnings := []string{}
+	for _, checked := range []struct {
+		cert *x509.Certificate
+		path string
+	}{{cert, pair.CertPath}, {cas[0], pair.CAPath}} {
+		err := checkValidity(checked.cert, v.Now)
+		if err == nil {
+			continue
+		}
+		if !v.AllowExpired {
+			return nil, &CertificateError{Path: checked.path, Err: err}
+		}
+		warnings = append(warnings, (&CertificateError{Path: checked.path, Err: err}).Error())
+	}
+
+	roots := x509.NewCertPool()
+	for _, ca := range cas {
+		roots.AddCert(ca)
+	}
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range chain[1:] {
+		intermediates.AddCert(intermediate)
+	}
+
+	// expired certificates that are allowed are verified at a time both
+	// they and the CA were valid, so that the chain is still checked
+	verifyTime := v.Now
+	if len(warnings) > 0 {
+		verifyTime = cert.NotBefore
+		if cas[0].NotBefore.After(verifyTime) {
+			verifyTime = cas[0].NotBefore
+		}
+	}
+
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   verifyTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, &CertificateError{Path: pair.CertPath, Err: fmt.Errorf("not signed by the CA in %s: %s", pair.CAPath, err)}
+	}
+
+	return warnings, nil
+}
+
+// parseCertificates parses all PEM encoded certificates in pemData, in
+// order.
+func parseCertificates(pemData string) ([]*x509.Certificate, error) {
+	if pemData == "" {
+		return nil, errors.New("certificate is empty")
+	}
+
+	certs := []*x509.Certificate{}
+	rest := []byte(pemData)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse certificate: %s", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, errors.New("no PEM encoded certificate found")
+	}
+	return certs, nil
+}
+
+func parsePrivateKey(pemData string) (crypto.Signer, error) {
+	if pemData == "" {
+		return nil, errors.New("private key is empty")
+	}
+
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil {
+		return nil, errors.New("no PEM encoded private key found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse private key: %s", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+	return signer, nil
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	aBytes, err := x509.MarshalPKIXPublicKey(a)
+	if err != nil {
+		return false
+	}
+	bBytes, err := x509.MarshalPKIXPublicKey(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aBytes, bBytes)
+}
+
+func checkValidity(cert *x509.Certificate, now time.Time) error {
+	if now.Before(cert.NotBefore) {
+		return fmt.Errorf("certificate is not valid before %s", cert.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(cert.NotAfter) {
+		return fmt.Errorf("certificate expired on %s", cert.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
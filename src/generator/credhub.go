@@ -0,0 +1,108 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"models"
+)
+
+// CredHubVariables resolves manifest variables from CredHub. Relative names
+// are looked up below Prefix, the /<director>/<deployment> namespace BOSH
+// uses for the variables it generates.
+type CredHubVariables struct {
+	URL        string
+	Prefix     string
+	HTTPClient *http.Client
+	UAA        *UAAClient
+}
+
+func NewCredHubVariables(httpClient *http.Client, credhubUrl, clientID, clientSecret, prefix string) (*CredHubVariables, error) {
+	httpClient = httpClientOrDefault(httpClient)
+	credhub := &CredHubVariables{
+		URL:        strings.TrimSuffix(credhubUrl, "/"),
+		Prefix:     strings.TrimSuffix(prefix, "/"),
+		HTTPClient: httpClient,
+	}
+
+	response, err := httpClient.Get(credhub.URL + "/info")
+	if err != nil {
+		return nil, &UnreachableError{Target: "CredHub", Err: err}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, unexpectedCredHubResponse(response)
+	}
+
+	info := models.CredHubInfo{}
+	err = json.NewDecoder(response.Body).Decode(&info)
+	if err != nil {
+		return nil, &UnreachableError{Target: "CredHub", Err: fmt.Errorf("invalid CredHub response: %v", err)}
+	}
+
+	credhub.UAA = NewUAAClient(httpClient, info.AuthServer.URL, clientID, clientSecret, "", "")
+	return credhub, nil
+}
+
+func (c *CredHubVariables) Get(name string) (interface{}, bool, error) {
+	if !strings.HasPrefix(name, "/") {
+		name = c.Prefix + "/" + name
+	}
+
+	request, err := http.NewRequest("GET", c.URL+"/api/v1/data?"+url.Values{
+		"name":    {name},
+		"current": {"true"},
+	}.Encode(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if c.UAA == nil {
+		return nil, false, &UsageError{"CredHub requires a UAA client, see NewCredHubVariables"}
+	}
+	token, err := c.UAA.AccessToken()
+	if err != nil {
+		return nil, false, err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	response, err := httpClientOrDefault(c.HTTPClient).Do(request)
+	if err != nil {
+		return nil, false, &UnreachableError{Target: "CredHub", Err: err}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, false, unexpectedCredHubResponse(response)
+	}
+
+	data := models.CredHubData{}
+	err = json.NewDecoder(response.Body).Decode(&data)
+	if err != nil {
+		return nil, false, &UnreachableError{Target: "CredHub", Err: fmt.Errorf("invalid CredHub response: %v", err)}
+	}
+
+	if len(data.Data) == 0 {
+		return nil, false, nil
+	}
+	return data.Data[0].Value, true, nil
+}
+
+func unexpectedCredHubResponse(response *http.Response) error {
+	buf := new(bytes.Buffer)
+	buf.ReadFrom(response.Body)
+	err := fmt.Errorf("unexpected CredHub response: %v, %v", response.StatusCode, buf.String())
+	if response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden {
+		return &AuthenticationError{Target: "CredHub", Err: err}
+	}
+	return &UnreachableError{Target: "CredHub", Err: err}
+}
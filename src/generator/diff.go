@@ -0,0 +1,80 @@
+package generator
+
+import (
+	"sort"
+
+	"models"
+)
+
+// ZoneChanges lists the changes of the install parameters of a zone, in
+// the format of DiffInstallParameters.
+type ZoneChanges struct {
+	Zone    string
+	Changes []string
+}
+
+// diffIgnoredParameters do not come from the manifest.
+var diffIgnoredParameters = []string{"MACHINE_IP", "STACK", "ADMIN_USERNAME", "ADMIN_PASSWORD"}
+
+// DiffManifests compares the install parameters derived from two manifests
+// loaded with LoadManifest, zone by zone. Secrets are compared by their
+// digest and certificates by their fingerprints, without validation. Zones
+// without changes are left out.
+func DiffManifests(previous, current models.Manifest, options Options) ([]ZoneChanges, error) {
+	// the options of the cell do not matter, only the manifests are
+	// compared. Invalid certificates are reported by the generation itself,
+	// they should not prevent seeing what changed.
+	options.Stack = "windows2016"
+	options.Username = ""
+	options.Password = ""
+	options.MachineIp = "0.0.0.0"
+	options.MachineInterface = ""
+	options.MachineSubnet = ""
+	options.SkipCertValidation = true
+	options.Upgrade = true
+
+	previousZones, err := zoneParameters(previous, options)
+	if err != nil {
+		return nil, err
+	}
+	currentZones, err := zoneParameters(current, options)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range previousZones {
+		names = append(names, name)
+	}
+	for name := range currentZones {
+		if _, ok := previousZones[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	diffs := []ZoneChanges{}
+	for _, name := range names {
+		changes := DiffInstallParameters(previousZones[name], currentZones[name])
+		if len(changes) > 0 {
+			diffs = append(diffs, ZoneChanges{Zone: name, Changes: changes})
+		}
+	}
+	return diffs, nil
+}
+
+func zoneParameters(manifest models.Manifest, options Options) (map[string]map[string]string, error) {
+	bundle, err := GenerateFromManifest(manifest, options)
+	if err != nil {
+		return nil, err
+	}
+
+	zones := map[string]map[string]string{}
+	for _, zone := range bundle.Zones {
+		for _, name := range diffIgnoredParameters {
+			delete(zone.Parameters, name)
+		}
+		zones[zone.Name] = zone.Parameters
+	}
+	return zones, nil
+}
@@ -0,0 +1,244 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Encrypted bundles start with a header naming how the key was derived,
+// followed by a ChaCha20-Poly1305 sealed payload that authenticates the
+// header as well:
+//
+//	diego-windows-bundle/v1
+//	passphrase <salt> <iterations>   or   x25519 <ephemeral public key>
+//	---
+//	<nonce><ciphertext>
+const (
+	encryptionMagic      = "diego-windows-bundle/v1"
+	encryptionSeparator  = "---"
+	passphraseIterations = 100000
+	x25519Info           = "diego-windows-bundle x25519"
+)
+
+// DecryptionError is returned when an encrypted bundle cannot be decrypted,
+// e.g. because of a wrong passphrase or key.
+type DecryptionError struct {
+	Err error
+}
+
+func (e *DecryptionError) Error() string {
+	return fmt.Sprintf("Unable to decrypt bundle. %s", e.Err)
+}
+
+func (e *DecryptionError) ExitCode() int {
+	return ExitCodeDecryption
+}
+
+// GenerateKeyPair returns a new X25519 private key and its public key, both
+// base64 encoded. Bundles encrypted for the public key can only be
+// decrypted with the private key.
+func GenerateKeyPair() (string, string, error) {
+	privateKey := make([]byte, curve25519.ScalarSize)
+	_, err := rand.Read(privateKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(privateKey), base64.StdEncoding.EncodeToString(publicKey), nil
+}
+
+// EncryptWithPassphrase encrypts data with a key derived from passphrase
+// using PBKDF2.
+func EncryptWithPassphrase(data []byte, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, &UsageError{"The encryption passphrase must not be empty"}
+	}
+
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	key := passphraseKey(passphrase, salt, passphraseIterations)
+	stanza := fmt.Sprintf("passphrase %s %d", base64.StdEncoding.EncodeToString(salt), passphraseIterations)
+	return seal(key, stanza, data)
+}
+
+// EncryptForRecipient encrypts data for the holder of the private key
+// matching the base64 encoded X25519 publicKey.
+func EncryptForRecipient(data []byte, publicKey string) ([]byte, error) {
+	recipient, err := decodeKey(publicKey)
+	if err != nil {
+		return nil, &UsageError{fmt.Sprintf("Invalid recipient key. %s", err)}
+	}
+
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	_, err = rand.Read(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	ephemeralPublic, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x25519Key(ephemeral, recipient, ephemeralPublic)
+	if err != nil {
+		return nil, &UsageError{fmt.Sprintf("Invalid recipient key. %s", err)}
+	}
+	return seal(key, "x25519 "+base64.StdEncoding.EncodeToString(ephemeralPublic), data)
+}
+
+// DecryptWithPassphrase decrypts a bundle encrypted with
+// EncryptWithPassphrase.
+func DecryptWithPassphrase(data []byte, passphrase string) ([]byte, error) {
+	header, fields, payload, err := parseEncrypted(data)
+	if err != nil {
+		return nil, err
+	}
+	if fields[0] != "passphrase" || len(fields) != 3 {
+		return nil, &DecryptionError{errors.New("the bundle was not encrypted with a passphrase")}
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, &DecryptionError{fmt.Errorf("invalid salt: %s", err)}
+	}
+	iterations, err := strconv.Atoi(fields[2])
+	if err != nil || iterations <= 0 {
+		return nil, &DecryptionError{fmt.Errorf("invalid iteration count %q", fields[2])}
+	}
+
+	return open(passphraseKey(passphrase, salt, iterations), header, payload)
+}
+
+// DecryptWithKey decrypts a bundle encrypted with EncryptForRecipient using
+// the base64 encoded X25519 privateKey.
+func DecryptWithKey(data []byte, privateKey string) ([]byte, error) {
+	header, fields, payload, err := parseEncrypted(data)
+	if err != nil {
+		return nil, err
+	}
+	if fields[0] != "x25519" || len(fields) != 2 {
+		return nil, &DecryptionError{errors.New("the bundle was not encrypted for a recipient key")}
+	}
+
+	identity, err := decodeKey(privateKey)
+	if err != nil {
+		return nil, &UsageError{fmt.Sprintf("Invalid private key. %s", err)}
+	}
+	ephemeralPublic, err := decodeKey(fields[1])
+	if err != nil {
+		return nil, &DecryptionError{fmt.Errorf("invalid ephemeral key: %s", err)}
+	}
+
+	key, err := x25519Key(identity, ephemeralPublic, ephemeralPublic)
+	if err != nil {
+		return nil, &DecryptionError{err}
+	}
+	return open(key, header, payload)
+}
+
+func passphraseKey(passphrase string, salt []byte, iterations int) []byte {
+	return pbkdf2.Key([]byte(passphrase), salt, iterations, chacha20poly1305.KeySize, sha256.New)
+}
+
+// x25519Key derives the payload key from the shared secret of scalar and
+// point, bound to the ephemeral public key of the bundle.
+func x25519Key(scalar, point, ephemeralPublic []byte) ([]byte, error) {
+	shared, err := curve25519.X25519(scalar, point)
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, chacha20poly1305.KeySize)
+	_, err = io.ReadFull(hkdf.New(sha256.New, shared, ephemeralPublic, []byte(x25519Info)), key)
+	return key, err
+}
+
+func decodeKey(key string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) != curve25519.PointSize {
+		return nil, fmt.Errorf("expected %d bytes, got %d", curve25519.PointSize, len(decoded))
+	}
+	return decoded, nil
+}
+
+func seal(key []byte, stanza string, data []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	header := []byte(encryptionMagic + "\n" + stanza + "\n" + encryptionSeparator + "\n")
+	out := append(header, nonce...)
+	return aead.Seal(out, nonce, data, header), nil
+}
+
+func open(key, header, payload []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < aead.NonceSize() {
+		return nil, &DecryptionError{errors.New("the bundle is truncated")}
+	}
+
+	data, err := aead.Open(nil, payload[:aead.NonceSize()], payload[aead.NonceSize():], header)
+	if err != nil {
+		return nil, &DecryptionError{errors.New("wrong passphrase or key, or the bundle was modified")}
+	}
+	return data, nil
+}
+
+// parseEncrypted splits an encrypted bundle into its header, the fields of
+// its key derivation stanza and the sealed payload.
+func parseEncrypted(data []byte) ([]byte, []string, []byte, error) {
+	reader := bufio.NewReader(bytes.NewReader(data))
+	lines := []string{}
+	for i := 0; i < 3; i++ {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, nil, nil, &DecryptionError{errors.New("not an encrypted bundle")}
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+
+	if lines[0] != encryptionMagic || lines[2] != encryptionSeparator {
+		return nil, nil, nil, &DecryptionError{errors.New("not an encrypted bundle")}
+	}
+	fields := strings.Fields(lines[1])
+	if len(fields) == 0 {
+		return nil, nil, nil, &DecryptionError{errors.New("missing key derivation")}
+	}
+
+	headerLength := len(lines[0]) + len(lines[1]) + len(lines[2]) + 3
+	return data[:headerLength], fields, data[headerLength:], nil
+}
@@ -0,0 +1,178 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Exit codes of the command line tool, documented in the README so that
+// automation can tell the failures apart.
+const (
+	ExitCodeUsage          = 1
+	ExitCodeUnreachable    = 2
+	ExitCodeAuthentication = 3
+	ExitCodeDeployment     = 4
+	ExitCodeManifest       = 5
+	ExitCodeOutput         = 6
+	ExitCodeExpiringCerts  = 7
+	ExitCodeDecryption     = 8
+)
+
+// UsageError is returned for invalid command line arguments.
+type UsageError struct {
+	Message string
+}
+
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+func (e *UsageError) ExitCode() int {
+	return ExitCodeUsage
+}
+
+// UnreachableError is returned when the director, UAA or CredHub cannot be
+// connected to.
+type UnreachableError struct {
+	Target string
+	Err    error
+}
+
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("Unable to establish connection to %s. %s", e.Target, e.Err)
+}
+
+func (e *UnreachableError) ExitCode() int {
+	return ExitCodeUnreachable
+}
+
+// AuthenticationError is returned when the director, UAA or CredHub reject
+// the given credentials.
+type AuthenticationError struct {
+	Target string
+	Err    error
+}
+
+func (e *AuthenticationError) Error() string {
+	return fmt.Sprintf("Unable to authenticate with %s. %s", e.Target, e.Err)
+}
+
+func (e *AuthenticationError) ExitCode() int {
+	return ExitCodeAuthentication
+}
+
+// DirectorResponseError is returned for unexpected director responses. The
+// exit code depends on the status, e.g. 401 is an authentication failure
+// and 404 a missing deployment.
+type DirectorResponseError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *DirectorResponseError) Error() string {
+	return fmt.Sprintf("Unexpected BOSH director response: %v, %v", e.StatusCode, e.Body)
+}
+
+func (e *DirectorResponseError) ExitCode() int {
+	switch e.StatusCode {
+	case 401, 403:
+		return ExitCodeAuthentication
+	case 404:
+		return ExitCodeDeployment
+	default:
+		return ExitCodeUnreachable
+	}
+}
+
+// DeploymentError is returned when the Diego deployment cannot be found, or
+// when several deployments qualify.
+type DeploymentError struct {
+	Candidates  []string
+	Deployments []string
+}
+
+func (e *DeploymentError) Error() string {
+	message := "BOSH Director does not have exactly one deployment containing a cf and diego release."
+	if len(e.Candidates) == 0 {
+		message += fmt.Sprintf(" No deployment matched, deployments found: %s.", strings.Join(e.Deployments, ", "))
+	} else {
+		message += fmt.Sprintf(" Candidate deployments: %s.", strings.Join(e.Candidates, ", "))
+	}
+	return message + " Use -deployment to choose one."
+}
+
+func (e *DeploymentError) ExitCode() int {
+	return ExitCodeDeployment
+}
+
+// MissingPropertyError is returned when the manifest lacks a property the
+// installer needs. Path is the property's YAML path, e.g. diego.rep.bbs.
+type MissingPropertyError struct {
+	Path    string
+	Message string
+}
+
+func (e *MissingPropertyError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("%s: missing manifest property %s", e.Message, e.Path)
+	}
+	return fmt.Sprintf("Missing manifest property %s", e.Path)
+}
+
+func (e *MissingPropertyError) ExitCode() int {
+	return ExitCodeManifest
+}
+
+// InvalidManifestError is returned when the manifest cannot be parsed or
+// interpolated.
+type InvalidManifestError struct {
+	Err error
+}
+
+func (e *InvalidManifestError) Error() string {
+	return fmt.Sprintf("Invalid deployment manifest: %s", e.Err)
+}
+
+func (e *InvalidManifestError) ExitCode() int {
+	return ExitCodeManifest
+}
+
+// OutputError is returned when the generated files cannot be written.
+type OutputError struct {
+	Path string
+	Err  error
+}
+
+func (e *OutputError) Error() string {
+	return fmt.Sprintf("Could not write %s: %s", e.Path, e.Err)
+}
+
+func (e *OutputError) ExitCode() int {
+	return ExitCodeOutput
+}
+
+// ExpiringCertificatesError is returned by the certificate report when
+// certificates expire within the given number of days.
+type ExpiringCertificatesError struct {
+	Days       int
+	Properties []string
+}
+
+func (e *ExpiringCertificatesError) Error() string {
+	return fmt.Sprintf("Certificates expiring within %d days: %s", e.Days, strings.Join(e.Properties, ", "))
+}
+
+func (e *ExpiringCertificatesError) ExitCode() int {
+	return ExitCodeExpiringCerts
+}
+
+// ExitCode returns the exit code of the command line tool for err. Errors
+// without a more specific code are reported as usage errors.
+func ExitCode(err error) int {
+	if coded, ok := err.(interface {
+		ExitCode() int
+	}); ok {
+		return coded.ExitCode()
+	}
+	return ExitCodeUsage
+}
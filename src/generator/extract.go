@@ -0,0 +1,196 @@
+package generator
+
+import (
+	"path"
+
+	"models"
+)
+
+// keyPairRole marks the files of a table that are validated together as a
+// key pair.
+type keyPairRole int
+
+const (
+	noKeyPair keyPairRole = iota
+	keyPairCA
+	keyPairCert
+	keyPairKey
+)
+
+// manifestFile is a file written from a manifest property. Required files
+// must have a value once their component is enabled, optional ones are
+// skipped when theirs is empty. Value returns "" for properties the
+// manifest does not set.
+type manifestFile struct {
+	Path     string
+	Filename string
+	Purpose  string
+	Required bool
+	Secret   bool
+	Role     keyPairRole
+	Value    func(*models.Properties) string
+}
+
+// manifestTables are the files of every component, the certificates report
+// covers their certificates.
+var manifestTables = [][]manifestFile{consulFiles, bbsFiles, metronFiles, etcdFiles}
+
+// The tables list the files of each component in the order they are
+// written. Every file gets its own entry, so properties sharing a value,
+// like a CA used for several components, are written once per file.
+var (
+	consulFiles = []manifestFile{
+		{
+			Path: "consul.ca_cert", Filename: "consul_ca.crt", Purpose: "Consul CA certificate",
+			Required: true, Role: keyPairCA,
+			Value: func(p *models.Properties) string { return consulProperties(p).CACert },
+		},
+		{
+			Path: "consul.agent_cert", Filename: "consul_agent.crt", Purpose: "Consul agent certificate",
+			Required: true, Role: keyPairCert,
+			Value: func(p *models.Properties) string { return consulProperties(p).AgentCert },
+		},
+		{
+			Path: "consul.agent_key", Filename: "consul_agent.key", Purpose: "Consul agent private key",
+			Required: true, Secret: true, Role: keyPairKey,
+			Value: func(p *models.Properties) string { return consulProperties(p).AgentKey },
+		},
+		{
+			Path: "consul.encrypt_keys", Filename: "consul_encrypt.key", Purpose: "Consul gossip encryption key",
+			Required: true, Secret: true,
+			Value: func(p *models.Properties) string {
+				keys := consulProperties(p).EncryptKeys
+				if len(keys) == 0 {
+					return ""
+				}
+				return stringToEncryptKey(keys[0])
+			},
+		},
+	}
+
+	bbsFiles = []manifestFile{
+		{
+			Path: "diego.rep.bbs.ca_cert", Filename: "bbs_ca.crt", Purpose: "BBS CA certificate",
+			Required: true, Role: keyPairCA,
+			Value: func(p *models.Properties) string { return bbsProperties(p).CACert },
+		},
+		{
+			Path: "diego.rep.bbs.client_cert", Filename: "bbs_client.crt", Purpose: "BBS client certificate",
+			Required: true, Role: keyPairCert,
+			Value: func(p *models.Properties) string { return bbsProperties(p).ClientCert },
+		},
+		{
+			Path: "diego.rep.bbs.client_key", Filename: "bbs_client.key", Purpose: "BBS client private key",
+			Required: true, Secret: true, Role: keyPairKey,
+			Value: func(p *models.Properties) string { return bbsProperties(p).ClientKey },
+		},
+	}
+
+	metronFiles = []manifestFile{
+		{
+			Path: "loggregator.tls.ca", Filename: "metron_ca.crt", Purpose: "Loggregator TLS CA certificate",
+			Required: true, Role: keyPairCA,
+			Value: func(p *models.Properties) string { return loggregatorProperties(p).Tls.CA },
+		},
+		{
+			Path: "metron_agent.tls_client.cert", Filename: "metron_agent.crt", Purpose: "Metron agent certificate",
+			Required: true, Role: keyPairCert,
+			Value: func(p *models.Properties) string { return metronAgentProperties(p).TlsClient.Cert },
+		},
+		{
+			Path: "metron_agent.tls_client.key", Filename: "metron_agent.key", Purpose: "Metron agent private key",
+			Required: true, Secret: true, Role: keyPairKey,
+			Value: func(p *models.Properties) string { return metronAgentProperties(p).TlsClient.Key },
+		},
+	}
+
+	etcdFiles = []manifestFile{
+		{
+			Path: "loggregator.etcd.ca_cert", Filename: "etcd_ca.crt", Purpose: "Loggregator etcd CA certificate",
+			Required: true, Role: keyPairCA,
+			Value: func(p *models.Properties) string { return loggregatorProperties(p).Etcd.CACert },
+		},
+		{
+			Path: "metron_agent.etcd.client_cert", Filename: "etcd_client.crt", Purpose: "Loggregator etcd client certificate",
+			Required: true, Role: keyPairCert,
+			Value: func(p *models.Properties) string { return metronAgentProperties(p).Etcd.ClientCert },
+		},
+		{
+			Path: "metron_agent.etcd.client_key", Filename: "etcd_client.key", Purpose: "Loggregator etcd client private key",
+			Required: true, Secret: true, Role: keyPairKey,
+			Value: func(p *models.Properties) string { return metronAgentProperties(p).Etcd.ClientKey },
+		},
+	}
+)
+
+// The accessors return empty properties for the sections the manifest does
+// not set.
+func consulProperties(p *models.Properties) models.ConsulProperties {
+	if p.Consul == nil {
+		return models.ConsulProperties{}
+	}
+	return *p.Consul
+}
+
+func bbsProperties(p *models.Properties) models.BBSProperties {
+	if p.Diego == nil || p.Diego.Rep == nil || p.Diego.Rep.BBS == nil {
+		return models.BBSProperties{}
+	}
+	return *p.Diego.Rep.BBS
+}
+
+func loggregatorProperties(p *models.Properties) models.LoggregatorProperties {
+	if p.Loggregator == nil {
+		return models.LoggregatorProperties{}
+	}
+	return *p.Loggregator
+}
+
+func metronAgentProperties(p *models.Properties) models.MetronAgent {
+	if p.MetronAgent == nil {
+		return models.MetronAgent{}
+	}
+	return *p.MetronAgent
+}
+
+// extractFiles reads the files of table from properties, validates the key
+// pair among them and adds them to files. A required file without a value
+// is an error rather than a missing file on the cell.
+func extractFiles(properties *models.Properties, table []manifestFile, files *fileSet) error {
+	contents := make([]string, len(table))
+	pair := keyPair{}
+	for i, file := range table {
+		contents[i] = file.Value(properties)
+		switch file.Role {
+		case keyPairCA:
+			pair.CA, pair.CAPath = contents[i], file.Path
+		case keyPairCert:
+			pair.Cert, pair.CertPath = contents[i], file.Path
+		case keyPairKey:
+			pair.Key, pair.KeyPath = contents[i], file.Path
+		}
+	}
+
+	if pair.CertPath != "" {
+		err := files.validate(pair)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, file := range table {
+		if contents[i] == "" && file.Required {
+			return &MissingPropertyError{Path: file.Path}
+		}
+		if contents[i] == "" {
+			continue
+		}
+		files.files = append(files.files, File{
+			Path:    path.Join(files.dir, file.Filename),
+			Purpose: file.Purpose,
+			Secret:  file.Secret,
+			Content: []byte(contents[i]),
+		})
+	}
+	return nil
+}
@@ -0,0 +1,453 @@
+// Package generator derives the install scripts of a Windows Diego cell, and
+// the certificates and keys they refer to, from a Diego deployment manifest.
+package generator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
+
+	"models"
+)
+
+const (
+	DefaultStack    = "windows2012R2"
+	defaultEtcdPort = 4001
+)
+
+// Options configures the generated scripts.
+type Options struct {
+	// Username and Password of the cell's admin account, only needed for
+	// stacks that install GardenWindows.msi.
+	Username string
+	Password string
+
+	// Stack of the cell, defaults to DefaultStack.
+	Stack string
+
+	// Zone overrides the redundancy zone. When empty and the manifest has
+	// rep jobs in several zones, a bundle is generated for every zone.
+	Zone string
+
+	// MachineIp of the cell. When empty, the address of MachineInterface
+	// and/or in MachineSubnet on this machine is used, or else the local
+	// address on the route to Consul. Detection is only correct when the
+	// generator runs on the cell, and loopback addresses are rejected.
+	MachineIp        string
+	MachineInterface string
+	MachineSubnet    string
+
+	// SkipCertValidation writes the certificates and keys of the manifest
+	// without checking them. AllowExpiredCerts turns certificates outside
+	// their validity period into warnings instead of errors.
+	SkipCertValidation bool
+	AllowExpiredCerts  bool
+
+	// SecretsFile moves the Loggregator shared secret and the admin password
+	// out of the install scripts into install_secrets.bat and
+	// install_secrets.json, which the scripts read and delete when run.
+	SecretsFile bool
+
+	// Variables resolve ((variable)) placeholders in the manifest, they are
+	// consulted in order and before CredHub.
+	Variables []VariableSource
+	CredHub   *CredHubOptions
+
+	// ContainersDir is removed by the uninstall scripts on cleanup, it
+	// defaults to DefaultContainersDir.
+	ContainersDir string
+
+	// Syslog provides the syslog settings when the manifest has none, as
+	// with Ops Manager, see OpsManagerSyslog.
+	Syslog SyslogSource
+
+	// Upgrade adds upgrade scripts and the parameters of the installation
+	// in install_params.json. The upgrade scripts reinstall only when the
+	// parameters or the MSIs changed since the last installation.
+	Upgrade bool
+}
+
+// CredHubOptions configures the lookup of manifest variables in CredHub. A
+// nil HTTPClient verifies CredHub against the system roots.
+type CredHubOptions struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+	HTTPClient   *http.Client
+
+	// DirectorName is used for relative variable names. It defaults to the
+	// name reported by the source, if the source is a director.
+	DirectorName string
+}
+
+// Bundle holds the generated files. Files of a zone are placed in a
+// directory named after the zone when the bundle covers several zones.
+type Bundle struct {
+	Files    []File
+	Zones    []Zone
+	Warnings []string
+}
+
+// File is a generated file, Path is relative to the root of the bundle.
+// Secret files contain private keys or credentials and are only readable
+// by their owner once written.
+type File struct {
+	Path    string
+	Purpose string
+	Secret  bool
+	Content []byte
+}
+
+type fileKind struct {
+	Purpose string
+	Secret  bool
+}
+
+// fileKinds describes the generated files of a bundle in its contents.json
+// and tells the secret ones from those that may be shared. The files taken
+// from the manifest are described by their extraction tables.
+var fileKinds = map[string]fileKind{
+	"install.bat":          {"Install script", true},
+	"install.ps1":          {"Install script (PowerShell)", true},
+	"install_secrets.bat":  {"Secrets read by the install script", true},
+	"install_secrets.json": {"Secrets read by the install script (PowerShell)", true},
+	"uninstall.bat":        {"Uninstall script", false},
+	"uninstall.ps1":        {"Uninstall script (PowerShell)", false},
+	"upgrade.bat":          {"Upgrade script", false},
+	"upgrade.ps1":          {"Upgrade script (PowerShell)", false},
+	"install_params.json":  {"Parameters of the installation", true},
+	"DiegoWindows.msi":     {"Diego installer", false},
+	"GardenWindows.msi":    {"Garden installer", false},
+	"contents.json":        {"List of files", false},
+}
+
+func newFile(filePath string, content []byte) File {
+	kind := fileKinds[path.Base(filePath)]
+	return File{Path: filePath, Purpose: kind.Purpose, Secret: kind.Secret, Content: content}
+}
+
+// AddMSIs adds the installers found in msiDir to the directory of every
+// zone. GardenWindows.msi is only added for stacks that install it.
+func (b *Bundle) AddMSIs(msiDir string) error {
+	for _, zone := range b.Zones {
+		msis := []string{"DiegoWindows.msi"}
+		if zone.Arguments.InstallGardenWindows {
+			msis = append(msis, "GardenWindows.msi")
+		}
+
+		for _, msi := range msis {
+			content, err := ioutil.ReadFile(filepath.Join(msiDir, msi))
+			if err != nil {
+				return &UsageError{fmt.Sprintf("Could not read installer: %v", err)}
+			}
+			b.Files = append(b.Files, newFile(path.Join(zone.Dir, msi), content))
+		}
+	}
+	return nil
+}
+
+// Contents lists every file of the bundle with its purpose and SHA-256.
+func (b *Bundle) Contents() models.BundleContents {
+	contents := models.BundleContents{Files: []models.BundleFile{}}
+	for _, file := range b.Files {
+		sum := sha256.Sum256(file.Content)
+		contents.Files = append(contents.Files, models.BundleFile{
+			File:    file.Path,
+			Purpose: file.Purpose,
+			Secret:  file.Secret,
+			SHA256:  hex.EncodeToString(sum[:]),
+		})
+	}
+	return contents
+}
+
+// WriteZip writes the bundle as a zip archive to w, together with a
+// contents.json describing its files.
+func (b *Bundle) WriteZip(w io.Writer) error {
+	sink := NewZipSink(w)
+	err := b.Write(sink)
+	if err != nil {
+		return err
+	}
+
+	contents, err := json.MarshalIndent(b.Contents(), "", "  ")
+	if err != nil {
+		return err
+	}
+	err = sink.WriteFile(newFile("contents.json", contents))
+	if err != nil {
+		return err
+	}
+	return sink.Close()
+}
+
+// Zone describes the scripts generated for one redundancy zone.
+type Zone struct {
+	Name      string
+	Dir       string
+	Arguments models.InstallerArguments
+
+	// Parameters are those recorded in install_params.json, only set in
+	// upgrade mode. Unlike the file, they hold the digests of the shared
+	// secret and the admin password.
+	Parameters map[string]string
+}
+
+// Write writes every file of the bundle to sink.
+func (b *Bundle) Write(sink Sink) error {
+	for _, file := range b.Files {
+		err := sink.WriteFile(file)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Generate fetches the manifest from source and generates the install
+// scripts for it.
+func Generate(ctx context.Context, source Source, options Options) (*Bundle, error) {
+	// the options are checked before the manifest is fetched
+	_, err := validateOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := LoadManifest(ctx, source, options)
+	if err != nil {
+		return nil, err
+	}
+	return GenerateFromManifest(manifest, options)
+}
+
+// GenerateFromManifest generates the install scripts for a manifest loaded
+// with LoadManifest, so that one manifest can serve many cells.
+func GenerateFromManifest(manifest models.Manifest, options Options) (*Bundle, error) {
+	stack, err := validateOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	args := models.InstallerArguments{
+		Username:             options.Username,
+		Password:             options.Password,
+		Stack:                stack.Name,
+		InstallGardenWindows: stack.InstallGardenWindows,
+		SecretsFile:          options.SecretsFile,
+		ContainersDir:        options.ContainersDir,
+	}
+	if args.ContainersDir == "" {
+		args.ContainersDir = DefaultContainersDir
+	}
+
+	certs := certValidation{
+		Skip:         options.SkipCertValidation,
+		AllowExpired: options.AllowExpiredCerts,
+		Now:          time.Now(),
+	}
+
+	machine := machineSelection{Ip: options.MachineIp, Interface: options.MachineInterface, Subnet: options.MachineSubnet}
+
+	bundle := &Bundle{}
+	zoneJobs := repJobsByZone(manifest)
+	if options.Zone != "" || len(zoneJobs) <= 1 {
+		err := generate(bundle, &fileSet{certs: certs}, args, manifestForZone(manifest, zoneJobs, options.Zone), options.Zone, machine, options.Syslog, options.Upgrade)
+		return bundle, err
+	}
+
+	// the manifest places rep jobs in several zones, generate the scripts of
+	// each zone into its own subdirectory
+	for _, zoneJob := range zoneJobs {
+		files := &fileSet{dir: zoneJob.Zone, certs: certs}
+		err := generate(bundle, files, args, manifestForRepJob(manifest, zoneJob.Job), zoneJob.Zone, machine, options.Syslog, options.Upgrade)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return bundle, nil
+}
+
+// LoadManifest fetches the manifest from source and resolves its variables
+// with the Variables and CredHub of options.
+func LoadManifest(ctx context.Context, source Source, options Options) (models.Manifest, error) {
+	var manifest models.Manifest
+
+	manifestYaml, err := source.Manifest(ctx)
+	if err != nil {
+		return manifest, err
+	}
+
+	// only the name is needed before the variables are resolved, the other
+	// properties may hold placeholders for values of any type
+	var header struct {
+		Name string `yaml:"name"`
+	}
+	err = candiedyaml.NewDecoder(bytes.NewBuffer(manifestYaml)).Decode(&header)
+	if err != nil {
+		return manifest, &InvalidManifestError{err}
+	}
+
+	sources := options.Variables
+	if options.CredHub != nil {
+		directorName := options.CredHub.DirectorName
+		if director, ok := source.(Director); ok && directorName == "" {
+			directorName = director.DirectorName()
+		}
+
+		credhub, err := NewCredHubVariables(options.CredHub.HTTPClient, options.CredHub.URL, options.CredHub.ClientID, options.CredHub.ClientSecret, "/"+directorName+"/"+header.Name)
+		if err != nil {
+			return manifest, err
+		}
+		sources = append(sources, credhub)
+	}
+
+	return InterpolateManifest(manifestYaml, sources)
+}
+
+func generate(bundle *Bundle, files *fileSet, args models.InstallerArguments, manifest models.Manifest, zone string, machine machineSelection, syslog SyslogSource, upgrade bool) error {
+	for _, fill := range []func() error{
+		func() error { return fillEtcdCluster(&args, manifest, files) },
+		func() error { return fillSharedSecret(&args, manifest) },
+		func() error { return fillMetronAgent(&args, manifest, files) },
+		func() error { return fillSyslog(&args, manifest, syslog) },
+		func() error { return fillConsul(&args, manifest, files) },
+		func() error { return fillMachineIp(&args, manifest, machine, files) },
+		func() error { return fillZone(&args, manifest, zone) },
+		func() error { return fillBBS(&args, manifest, files) },
+	} {
+		err := fill()
+		if err != nil {
+			return err
+		}
+	}
+
+	manifestFiles := files.files
+	err := generateUninstallScript(files, args)
+	if err != nil {
+		return err
+	}
+	err = generateInstallScript(files, args)
+	if err != nil {
+		return err
+	}
+
+	var parameters map[string]string
+	if upgrade {
+		parameters, err = generateUpgradeScript(files, args, manifestFiles)
+		if err != nil {
+			return err
+		}
+	}
+
+	bundle.Files = append(bundle.Files, files.files...)
+	bundle.Warnings = append(bundle.Warnings, files.warnings...)
+	bundle.Zones = append(bundle.Zones, Zone{Name: args.Zone, Dir: files.dir, Arguments: args, Parameters: parameters})
+	return nil
+}
+
+// fileSet collects the files generated for one zone, and the warnings
+// raised while validating their certificates.
+type fileSet struct {
+	dir      string
+	files    []File
+	certs    certValidation
+	warnings []string
+}
+
+func (s *fileSet) validate(pair keyPair) error {
+	warnings, err := s.certs.validate(pair)
+	s.warnings = append(s.warnings, warnings...)
+	return err
+}
+
+func (s *fileSet) add(name, content string) {
+	s.files = append(s.files, newFile(path.Join(s.dir, name), []byte(content)))
+}
+
+// addPublic adds a file that is secret by default, such as an install
+// script, whose secrets have been moved elsewhere.
+func (s *fileSet) addPublic(name, content string) {
+	file := newFile(path.Join(s.dir, name), []byte(content))
+	file.Secret = false
+	s.files = append(s.files, file)
+}
+
+// StackOptions captures how the installation differs between the Windows
+// versions, and with them the MSI generations, supported by the generator.
+type StackOptions struct {
+	Name string
+	// InstallGardenWindows is only set for Windows Server 2012 R2, where
+	// GardenWindows.msi sets up the containerizer and its admin account.
+	// Later versions run containers natively and have no use for it.
+	InstallGardenWindows bool
+}
+
+// KnownStacks lists the stacks the generator can produce scripts for.
+var KnownStacks = []StackOptions{
+	{Name: "windows2012R2", InstallGardenWindows: true},
+	{Name: "windows2016", InstallGardenWindows: false},
+}
+
+func validateOptions(options Options) (StackOptions, error) {
+	if options.Stack == "" {
+		options.Stack = DefaultStack
+	}
+	stack, err := validateStack(options.Stack)
+	if err != nil {
+		return stack, err
+	}
+	if stack.InstallGardenWindows {
+		err := validateCredentials(options.Username, options.Password)
+		if err != nil {
+			return stack, err
+		}
+	}
+	return stack, nil
+}
+
+func findStack(name string) (StackOptions, bool) {
+	for _, stack := range KnownStacks {
+		if stack.Name == name {
+			return stack, true
+		}
+	}
+	return StackOptions{}, false
+}
+
+func validateStack(name string) (StackOptions, error) {
+	stack, ok := findStack(name)
+	if !ok {
+		names := []string{}
+		for _, known := range KnownStacks {
+			names = append(names, known.Name)
+		}
+		return stack, &UsageError{fmt.Sprintf("Invalid stack %s, must be one of: %s", name, strings.Join(names, ", "))}
+	}
+	return stack, nil
+}
+
+func validateCredentials(username, password string) error {
+	pattern := regexp.MustCompile("^[a-zA-Z0-9]+$")
+
+	if !pattern.Match([]byte(username)) {
+		return &UsageError{"Invalid windowsUsername, must be alphanumeric"}
+	}
+
+	if strings.Contains(password, `"`) {
+		return &UsageError{"Invalid windowsPassword, must not contain double-quotes"}
+	}
+	return nil
+}
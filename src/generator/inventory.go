@@ -0,0 +1,171 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
+)
+
+// Cell is one row of an inventory. Zone, Username and Password are
+// optional and default to the values given for all cells.
+type Cell struct {
+	Hostname  string `yaml:"hostname"`
+	MachineIp string `yaml:"machine_ip"`
+	Zone      string `yaml:"zone"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+}
+
+// inventoryColumns are the columns of a CSV inventory, its first line must
+// name them. Only hostname and machine_ip are required.
+var inventoryColumns = []string{"hostname", "machine_ip", "zone", "username", "password"}
+
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9.-]*$`)
+
+// LoadInventory reads the cells to generate scripts for from a CSV file
+// with a header line, or from a YAML list when filename ends in .yml or
+// .yaml.
+func LoadInventory(filename string) ([]Cell, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, &UsageError{fmt.Sprintf("Could not read inventory: %v", err)}
+	}
+
+	var cells []Cell
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yml", ".yaml":
+		cells, err = parseYamlInventory(content)
+	default:
+		cells, err = parseCsvInventory(content)
+	}
+	if err != nil {
+		return nil, &UsageError{fmt.Sprintf("Invalid inventory %s: %v", filename, err)}
+	}
+
+	err = validateInventory(cells)
+	if err != nil {
+		return nil, &UsageError{fmt.Sprintf("Invalid inventory %s: %v", filename, err)}
+	}
+	return cells, nil
+}
+
+func parseYamlInventory(content []byte) ([]Cell, error) {
+	cells := []Cell{}
+	err := candiedyaml.NewDecoder(bytes.NewBuffer(content)).Decode(&cells)
+	return cells, err
+}
+
+func parseCsvInventory(content []byte) ([]Cell, error) {
+	reader := csv.NewReader(bytes.NewBuffer(content))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("missing header line")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !isInventoryColumn(name) {
+			return nil, fmt.Errorf("unknown column %q, expected %s", name, strings.Join(inventoryColumns, ", "))
+		}
+		columns[name] = i
+	}
+	for _, required := range []string{"hostname", "machine_ip"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("missing column %s", required)
+		}
+	}
+
+	cells := []Cell{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return cells, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		value := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		cells = append(cells, Cell{
+			Hostname:  value("hostname"),
+			MachineIp: value("machine_ip"),
+			Zone:      value("zone"),
+			Username:  value("username"),
+			Password:  value("password"),
+		})
+	}
+}
+
+func isInventoryColumn(name string) bool {
+	for _, column := range inventoryColumns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validateInventory checks that every cell has a hostname usable as its
+// output directory and a machine IP, as detecting the IP only works for the
+// machine the generator runs on.
+func validateInventory(cells []Cell) error {
+	if len(cells) == 0 {
+		return fmt.Errorf("no cells listed")
+	}
+
+	seen := map[string]bool{}
+	for i, cell := range cells {
+		if !hostnamePattern.MatchString(cell.Hostname) {
+			return fmt.Errorf("cell %d: invalid hostname %q", i+1, cell.Hostname)
+		}
+		if seen[strings.ToLower(cell.Hostname)] {
+			return fmt.Errorf("cell %d: duplicate hostname %s", i+1, cell.Hostname)
+		}
+		seen[strings.ToLower(cell.Hostname)] = true
+
+		if cell.MachineIp == "" {
+			return fmt.Errorf("cell %s: missing machine_ip", cell.Hostname)
+		}
+		if net.ParseIP(cell.MachineIp) == nil {
+			return fmt.Errorf("cell %s: invalid machine_ip %q", cell.Hostname, cell.MachineIp)
+		}
+	}
+	return nil
+}
+
+// ForCell returns a copy of the options with the machine IP, zone and
+// credentials of cell.
+func (o Options) ForCell(cell Cell) Options {
+	o.MachineIp = cell.MachineIp
+	if cell.Zone != "" {
+		o.Zone = cell.Zone
+	}
+	if cell.Username != "" {
+		o.Username = cell.Username
+	}
+	if cell.Password != "" {
+		o.Password = cell.Password
+	}
+	return o
+}
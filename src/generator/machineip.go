@@ -0,0 +1,156 @@
+package generator
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// detectionPort is dialed to find the local address on the route to Consul,
+// no packet is sent.
+const detectionPort = "65530"
+
+// machineSelection is how the IP of the cell is chosen: the given Ip, the
+// address of Interface and/or in Subnet on this machine, or the local
+// address on the route to Consul.
+type machineSelection struct {
+	Ip        string
+	Interface string
+	Subnet    string
+}
+
+// detectMachineIp finds the IP of the machine the generator runs on. It is
+// only the cell's IP when the generator runs on the cell, which is why a
+// warning is returned when that is unlikely.
+func detectMachineIp(selection machineSelection, consulIPs string) (string, []string, error) {
+	var ip net.IP
+	var err error
+	if selection.Interface != "" || selection.Subnet != "" {
+		ip, err = selectInterfaceIp(selection.Interface, selection.Subnet)
+	} else {
+		ip, err = routeIp(consulIPs)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	warnings := []string{}
+	if runtime.GOOS != "windows" {
+		hostname, _ := os.Hostname()
+		warnings = append(warnings, fmt.Sprintf("Detected machine IP %s on %s, which does not run Windows. The scripts are only correct for the cell with this IP, use -machineIp to set the cell's IP", ip, hostname))
+	}
+	return ip.String(), warnings, nil
+}
+
+// routeIp returns the local address on the route to the first Consul
+// server, which may be given as a hostname and with a port.
+func routeIp(consulIPs string) (net.IP, error) {
+	consul := strings.TrimSpace(strings.Split(consulIPs, ",")[0])
+	if consul == "" {
+		return nil, &UsageError{"Could not detect the machine IP, the manifest lists no Consul server. Use -machineIp"}
+	}
+	if host, _, err := net.SplitHostPort(consul); err == nil {
+		consul = host
+	}
+
+	conn, err := net.Dial("udp", net.JoinHostPort(consul, detectionPort))
+	if err != nil {
+		return nil, &UsageError{fmt.Sprintf("Could not detect the machine IP, use -machineIp. %s", err)}
+	}
+	defer conn.Close()
+
+	ip := conn.LocalAddr().(*net.UDPAddr).IP
+	if ip.IsLoopback() {
+		return nil, &UsageError{fmt.Sprintf("Could not detect the machine IP, the route to Consul at %s uses the loopback address %s. Use -machineIp", consul, ip)}
+	}
+	return ip, nil
+}
+
+// selectInterfaceIp returns the address of the named interface, or of any
+// interface when name is empty, that lies in subnet if given. Loopback and
+// link-local addresses are skipped and IPv4 addresses are preferred.
+func selectInterfaceIp(name, subnet string) (net.IP, error) {
+	var network *net.IPNet
+	if subnet != "" {
+		var err error
+		_, network, err = net.ParseCIDR(subnet)
+		if err != nil {
+			return nil, &UsageError{fmt.Sprintf("Invalid machineSubnet %s, must be in CIDR notation", subnet)}
+		}
+	}
+
+	var interfaces []net.Interface
+	if name != "" {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			return nil, &UsageError{fmt.Sprintf("Invalid machineInterface %s: %s", name, err)}
+		}
+		interfaces = []net.Interface{*iface}
+	} else {
+		var err error
+		interfaces, err = net.Interfaces()
+		if err != nil {
+			return nil, &UsageError{fmt.Sprintf("Could not list the network interfaces: %s", err)}
+		}
+	}
+
+	var v4, v6 []net.IP
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, &UsageError{fmt.Sprintf("Could not read the addresses of interface %s: %s", iface.Name, err)}
+		}
+
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			if network != nil && !network.Contains(ipNet.IP) {
+				continue
+			}
+			if ipNet.IP.To4() != nil {
+				v4 = append(v4, ipNet.IP)
+			} else {
+				v6 = append(v6, ipNet.IP)
+			}
+		}
+	}
+
+	candidates := v4
+	if len(candidates) == 0 {
+		candidates = v6
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, &UsageError{fmt.Sprintf("Could not detect the machine IP, %s has no non-loopback address%s. Use -machineIp", describeInterface(name), describeSubnet(subnet))}
+	case 1:
+		return candidates[0], nil
+	default:
+		ips := []string{}
+		for _, ip := range candidates {
+			ips = append(ips, ip.String())
+		}
+		return nil, &UsageError{fmt.Sprintf("Could not detect the machine IP, %s has several addresses%s: %s. Use -machineSubnet or -machineIp", describeInterface(name), describeSubnet(subnet), strings.Join(ips, ", "))}
+	}
+}
+
+func describeInterface(name string) string {
+	if name == "" {
+		return "this machine"
+	}
+	return "interface " + name
+}
+
+func describeSubnet(subnet string) string {
+	if subnet == "" {
+		return ""
+	}
+	return " in " + subnet
+}
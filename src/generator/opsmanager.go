@@ -0,0 +1,135 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"models"
+)
+
+const (
+	// opsman is the public UAA client of Ops Manager for password grants.
+	opsManagerPasswordGrantClient = "opsman"
+
+	// opsManagerProductType is the type of the Elastic Runtime tile, which
+	// holds the syslog settings of the platform.
+	opsManagerProductType = "cf"
+
+	opsManagerSyslogHost = ".properties.syslog_host"
+	opsManagerSyslogPort = ".properties.syslog_port"
+)
+
+// SyslogSource provides the syslog settings of the cells when the manifest
+// does not contain them.
+type SyslogSource interface {
+	// Syslog returns nil when no syslog server is configured.
+	Syslog() (*models.SyslogProperties, error)
+}
+
+// OpsManagerSyslog reads the syslog settings of the Elastic Runtime tile
+// from the Ops Manager API. The settings are fetched once.
+type OpsManagerSyslog struct {
+	URL        string
+	HTTPClient *http.Client
+	UAA        *UAAClient
+
+	fetched bool
+	syslog  *models.SyslogProperties
+}
+
+// NewOpsManagerSyslog authenticates with the UAA of the Ops Manager at
+// opsManagerUrl, with username and password or with a client.
+func NewOpsManagerSyslog(httpClient *http.Client, opsManagerUrl, clientID, clientSecret, username, password string) *OpsManagerSyslog {
+	opsManagerUrl = strings.TrimSuffix(opsManagerUrl, "/")
+	if clientID == "" {
+		clientID = opsManagerPasswordGrantClient
+	}
+
+	return &OpsManagerSyslog{
+		URL:        opsManagerUrl,
+		HTTPClient: httpClient,
+		UAA:        NewUAAClient(httpClient, opsManagerUrl+"/uaa", clientID, clientSecret, username, password),
+	}
+}
+
+func (o *OpsManagerSyslog) Syslog() (*models.SyslogProperties, error) {
+	if o.fetched {
+		return o.syslog, nil
+	}
+
+	products := []models.OpsManagerProduct{}
+	err := o.get("/api/v0/staged/products", &products)
+	if err != nil {
+		return nil, err
+	}
+
+	guid := ""
+	for _, product := range products {
+		if product.Type == opsManagerProductType {
+			guid = product.GUID
+			break
+		}
+	}
+	if guid == "" {
+		return nil, &MissingPropertyError{Path: "syslog_daemon_config", Message: "Ops Manager has no staged Elastic Runtime product"}
+	}
+
+	properties := models.OpsManagerProperties{}
+	err = o.get("/api/v0/staged/products/"+guid+"/properties", &properties)
+	if err != nil {
+		return nil, err
+	}
+
+	o.fetched = true
+	host := properties.Properties[opsManagerSyslogHost].Value
+	if host == nil || fmt.Sprint(host) == "" {
+		return nil, nil
+	}
+
+	o.syslog = &models.SyslogProperties{Address: fmt.Sprint(host)}
+	if port := properties.Properties[opsManagerSyslogPort].Value; port != nil {
+		o.syslog.Port = fmt.Sprint(port)
+	}
+	return o.syslog, nil
+}
+
+func (o *OpsManagerSyslog) get(endpoint string, result interface{}) error {
+	request, err := http.NewRequest("GET", o.URL+endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	if o.UAA == nil {
+		return &UsageError{"Ops Manager requires a UAA client, see NewOpsManagerSyslog"}
+	}
+	token, err := o.UAA.AccessToken()
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	response, err := httpClientOrDefault(o.HTTPClient).Do(request)
+	if err != nil {
+		return &UnreachableError{Target: "Ops Manager", Err: err}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(response.Body)
+		err := fmt.Errorf("unexpected Ops Manager response: %v, %v", response.StatusCode, buf.String())
+		if response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden {
+			return &AuthenticationError{Target: "Ops Manager", Err: err}
+		}
+		return &UnreachableError{Target: "Ops Manager", Err: err}
+	}
+
+	err = json.NewDecoder(response.Body).Decode(result)
+	if err != nil {
+		return &UnreachableError{Target: "Ops Manager", Err: fmt.Errorf("invalid Ops Manager response: %v", err)}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package generator
+
+import (
+	"strings"
+	"text/template"
+)
+
+const (
+	installPs1Template = `$ErrorActionPreference = "Stop"
+
+function Install-Msi {
+    param(
+        [string]$Msi,
+        [System.Collections.Specialized.OrderedDictionary]$Properties
+    )
+
+    $msiPath = Join-Path $PSScriptRoot $Msi
+    $logPath = Join-Path $PSScriptRoot ([System.IO.Path]::GetFileNameWithoutExtension($Msi) + ".log")
+
+    # msiexec expects quoted values, "" is an escaped quote in PowerShell strings.
+    # Only status messages, warnings and errors are logged, verbose logs list
+    # the properties with the admin password and the shared secret.
+    $arguments = @("/passive", "/norestart", "/i", """$msiPath""", "/liwe", """$logPath""")
+    foreach ($property in $Properties.GetEnumerator()) {
+        $arguments += "$($property.Key)=""$($property.Value)"""
+    }
+
+    Write-Host "Installing $Msi, logging to $logPath"
+    $process = Start-Process -FilePath "msiexec.exe" -ArgumentList $arguments -Wait -PassThru
+
+    # 3010: the installation succeeded but a reboot is required
+    if ($process.ExitCode -ne 0 -and $process.ExitCode -ne 3010) {
+        $host.UI.WriteErrorLine("Installing $Msi failed with exit code $($process.ExitCode), see $logPath")
+        exit $process.ExitCode
+    }
+}
+
+{{ if .SecretsFile }}# the secrets are kept out of this script, read them and remove them from disk
+$secretsPath = Join-Path $PSScriptRoot 'install_secrets.json'
+if (-not (Test-Path $secretsPath)) {
+    $host.UI.WriteErrorLine("$secretsPath is missing")
+    exit 1
+}
+$secrets = Get-Content -Raw $secretsPath | ConvertFrom-Json
+Remove-Item $secretsPath
+
+{{ end }}$diegoProperties = [ordered]@{ {{ if .BbsRequireSsl }}
+    BBS_CA_FILE = (Join-Path $PSScriptRoot 'bbs_ca.crt')
+    BBS_CLIENT_CERT_FILE = (Join-Path $PSScriptRoot 'bbs_client.crt')
+    BBS_CLIENT_KEY_FILE = (Join-Path $PSScriptRoot 'bbs_client.key'){{ end }}
+    CONSUL_IPS = {{ps .ConsulIPs}}
+    CF_ETCD_CLUSTER = {{ps .EtcdCluster}}
+    STACK = {{ps .Stack}}
+    REDUNDANCY_ZONE = {{ps .Zone}}
+    LOGGREGATOR_SHARED_SECRET = {{ if .SecretsFile }}$secrets.LOGGREGATOR_SHARED_SECRET{{ else }}{{ps .SharedSecret}}{{ end }}
+    MACHINE_IP = {{ps .MachineIp}}{{ if .SyslogHostIP }}
+    SYSLOG_HOST_IP = {{ps .SyslogHostIP}}
+    SYSLOG_PORT = {{ps .SyslogPort}}{{ end }}{{ if .ConsulRequireSSL }}
+    CONSUL_ENCRYPT_FILE = (Join-Path $PSScriptRoot 'consul_encrypt.key')
+    CONSUL_CA_FILE = (Join-Path $PSScriptRoot 'consul_ca.crt')
+    CONSUL_AGENT_CERT_FILE = (Join-Path $PSScriptRoot 'consul_agent.crt')
+    CONSUL_AGENT_KEY_FILE = (Join-Path $PSScriptRoot 'consul_agent.key'){{ end }}{{ if .MetronPreferTLS }}
+    METRON_CA_FILE = (Join-Path $PSScriptRoot 'metron_ca.crt')
+    METRON_AGENT_CERT_FILE = (Join-Path $PSScriptRoot 'metron_agent.crt')
+    METRON_AGENT_KEY_FILE = (Join-Path $PSScriptRoot 'metron_agent.key'){{ end }}{{ if .EtcdRequireSSL }}
+    ETCD_CA_FILE = (Join-Path $PSScriptRoot 'etcd_ca.crt')
+    ETCD_CERT_FILE = (Join-Path $PSScriptRoot 'etcd_client.crt')
+    ETCD_KEY_FILE = (Join-Path $PSScriptRoot 'etcd_client.key'){{ end }}
+}{{ if .InstallGardenWindows }}
+
+$gardenProperties = [ordered]@{
+    ADMIN_USERNAME = {{ps .Username}}
+    ADMIN_PASSWORD = {{ if .SecretsFile }}$secrets.ADMIN_PASSWORD{{ else }}{{ps .Password}}{{ end }}
+    MACHINE_IP = {{ps .MachineIp}}{{ if .SyslogHostIP }}
+    SYSLOG_HOST_IP = {{ps .SyslogHostIP}}
+    SYSLOG_PORT = {{ps .SyslogPort}}{{ end }}
+}{{ end }}
+
+Install-Msi -Msi "DiegoWindows.msi" -Properties $diegoProperties{{ if .InstallGardenWindows }}
+Install-Msi -Msi "GardenWindows.msi" -Properties $gardenProperties{{ end }}`
+)
+
+var powershellFuncs = template.FuncMap{
+	"ps": powershellQuote,
+}
+
+// powershellQuote returns str as a single-quoted PowerShell literal, in which
+// only the single quote itself needs escaping.
+func powershellQuote(str string) string {
+	return "'" + strings.Replace(str, "'", "''", -1) + "'"
+}
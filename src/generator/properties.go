@@ -0,0 +1,462 @@
+package generator
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"models"
+)
+
+func fillMachineIp(args *models.InstallerArguments, manifest models.Manifest, selection machineSelection, files *fileSet) error {
+	if selection.Ip != "" {
+		if net.ParseIP(selection.Ip) == nil {
+			return &UsageError{fmt.Sprintf("Invalid machineIp %s", selection.Ip)}
+		}
+		args.MachineIp = selection.Ip
+		return nil
+	}
+
+	machineIp, warnings, err := detectMachineIp(selection, args.ConsulIPs)
+	if err != nil {
+		return err
+	}
+	files.warnings = append(files.warnings, warnings...)
+	args.MachineIp = machineIp
+	return nil
+}
+
+func fillZone(args *models.InstallerArguments, manifest models.Manifest, zone string) error {
+	if zone == "" {
+		repJob, err := firstRepJob(manifest)
+		if err != nil {
+			return err
+		}
+		zone = repZone(repJob)
+	}
+	if zone == "" {
+		zone = "windows"
+	}
+	args.Zone = zone
+	return nil
+}
+
+// repOrGlobalProperties returns the properties of the rep job if they
+// satisfy has, the global properties of the manifest if those do, and nil
+// otherwise.
+func repOrGlobalProperties(manifest models.Manifest, has func(*models.Properties) bool) (*models.Properties, error) {
+	repJob, err := firstRepJob(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, properties := range []*models.Properties{repJob.Properties, manifest.Properties} {
+		if properties != nil && has(properties) {
+			return properties, nil
+		}
+	}
+	return nil, nil
+}
+
+func fillSharedSecret(args *models.InstallerArguments, manifest models.Manifest) error {
+	properties, err := repOrGlobalProperties(manifest, func(p *models.Properties) bool {
+		return p.MetronEndpoint != nil
+	})
+	if err != nil {
+		return err
+	}
+	if properties == nil {
+		return &MissingPropertyError{Path: "metron_endpoint.shared_secret"}
+	}
+
+	args.SharedSecret = properties.MetronEndpoint.SharedSecret
+	return nil
+}
+
+func fillMetronAgent(args *models.InstallerArguments, manifest models.Manifest, files *fileSet) error {
+	properties, err := repOrGlobalProperties(manifest, func(p *models.Properties) bool {
+		return p.MetronAgent != nil && p.MetronAgent.PreferredProtocol != nil
+	})
+	if err != nil || properties == nil {
+		return err
+	}
+
+	if *properties.MetronAgent.PreferredProtocol == "tls" {
+		args.MetronPreferTLS = true
+		return extractMetronKeyAndCert(properties, files)
+	}
+	return nil
+}
+
+func fillSyslog(args *models.InstallerArguments, manifest models.Manifest, source SyslogSource) error {
+	properties, err := repOrGlobalProperties(manifest, func(p *models.Properties) bool {
+		return p.Syslog != nil || p.SyslogForwarder != nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var syslog *models.SyslogProperties
+	if properties != nil {
+		syslog = properties.Syslog
+		if syslog == nil {
+			// syslog-release's syslog_forwarder job, as colocated in v2 manifests
+			syslog = properties.SyslogForwarder
+		}
+	} else if source != nil {
+		// Ops Manager keeps the syslog settings of the cells out of the manifest
+		syslog, err = source.Syslog()
+		if err != nil {
+			return err
+		}
+	}
+	if syslog == nil {
+		return nil
+	}
+
+	args.SyslogHostIP = syslog.Address
+	args.SyslogPort = syslog.Port
+	return nil
+}
+
+func fillBBS(args *models.InstallerArguments, manifest models.Manifest, files *fileSet) error {
+	properties, err := repOrGlobalProperties(manifest, func(p *models.Properties) bool {
+		return p.Diego != nil && p.Diego.Rep != nil && p.Diego.Rep.BBS != nil
+	})
+	if err != nil {
+		return err
+	}
+	if properties == nil {
+		return &MissingPropertyError{Path: "diego.rep.bbs"}
+	}
+
+	requireSSL := properties.Diego.Rep.BBS.RequireSSL
+	// missing requireSSL implies true
+	if requireSSL == nil || *requireSSL {
+		args.BbsRequireSsl = true
+		return extractBbsKeyAndCert(properties, files)
+	}
+	return nil
+}
+
+func stringToEncryptKey(str string) string {
+	decodedStr, err := base64.StdEncoding.DecodeString(str)
+	if err == nil && len(decodedStr) == 16 {
+		return str
+	}
+
+	key := pbkdf2.Key([]byte(str), nil, 20000, 16, sha1.New)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func fillConsul(args *models.InstallerArguments, manifest models.Manifest, files *fileSet) error {
+	properties, err := repOrGlobalProperties(manifest, func(p *models.Properties) bool {
+		return p.Consul != nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if properties == nil || len(properties.Consul.Agent.Servers.Lan) == 0 {
+		return &MissingPropertyError{
+			Path:    "consul.agent.servers.lan",
+			Message: "Could not find any Consul VMs in your BOSH deployment",
+		}
+	}
+
+	// missing requireSSL implies true
+	requireSSL := properties.Consul.RequireSSL
+	if requireSSL == nil || *requireSSL {
+		args.ConsulRequireSSL = true
+		err := extractConsulKeyAndCert(properties, files)
+		if err != nil {
+			return err
+		}
+	}
+
+	args.ConsulIPs = strings.Join(properties.Consul.Agent.Servers.Lan, ",")
+	return nil
+}
+
+func fillEtcdCluster(args *models.InstallerArguments, manifest models.Manifest, files *fileSet) error {
+	properties, err := repOrGlobalProperties(manifest, func(p *models.Properties) bool {
+		return p.Loggregator != nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if properties == nil || len(properties.Loggregator.Etcd.Machines) == 0 {
+		return &MissingPropertyError{Path: "loggregator.etcd.machines"}
+	}
+
+	etcd := properties.Loggregator.Etcd
+
+	// missing requireSSL implies false
+	scheme := "http"
+	if etcd.RequireSSL != nil && *etcd.RequireSSL {
+		scheme = "https"
+		args.EtcdRequireSSL = true
+
+		metronAgent := properties.MetronAgent
+		if (metronAgent == nil || metronAgent.Etcd.ClientCert == "") && manifest.Properties != nil && manifest.Properties.MetronAgent != nil {
+			metronAgent = manifest.Properties.MetronAgent
+		}
+		err := extractEtcdKeyAndCert(properties.Loggregator, metronAgent, files)
+		if err != nil {
+			return err
+		}
+	}
+
+	port := etcd.Port
+	if port == 0 {
+		port = defaultEtcdPort
+	}
+
+	urls := []string{}
+	for _, machine := range etcd.Machines {
+		urls = append(urls, fmt.Sprintf("%s://%s:%d", scheme, machine, port))
+	}
+	args.EtcdCluster = strings.Join(urls, ",")
+	return nil
+}
+
+func firstRepJob(manifest models.Manifest) (models.Job, error) {
+	jobs := allRepJobs(manifest)
+	if len(jobs) == 0 {
+		return models.Job{}, &MissingPropertyError{Path: "diego.rep", Message: "Could not find a rep job in your BOSH deployment"}
+	}
+	return jobs[0], nil
+}
+
+func allRepJobs(manifest models.Manifest) []models.Job {
+	repJobs := []models.Job{}
+
+	for _, job := range manifest.Jobs {
+		if job.Properties != nil && job.Properties.Diego != nil && job.Properties.Diego.Rep != nil {
+			job.Properties = withOpsManagerFallbacks(manifest, job.Properties)
+			repJobs = append(repJobs, job)
+		}
+	}
+
+	// BOSH v2 manifests keep properties on each job of an instance group, so
+	// the rep job only knows about its own properties. Consul, metron and
+	// syslog settings live on the jobs colocated with it.
+	for _, group := range manifest.InstanceGroups {
+		for _, job := range group.Jobs {
+			if isRepJob(job) {
+				repJobs = append(repJobs, models.Job{
+					Name:       group.Name,
+					Properties: withOpsManagerFallbacks(manifest, mergeInstanceGroupProperties(job, group.Jobs)),
+				})
+				break
+			}
+		}
+	}
+
+	return repJobs
+}
+
+// opsManagerGroups are the instance groups, or jobs of v1 manifests, of
+// Ops Manager's Diego, by name prefix. Ops Manager may append a partition
+// to the names.
+var opsManagerGroups = []string{"diego_cell", "diego_brain"}
+
+// isOpsManagerManifest tells manifests generated by Ops Manager by their
+// Diego cell instance group. Other manifests without global properties,
+// such as BOSH v2 ones, keep the properties of their rep's instance group.
+func isOpsManagerManifest(manifest models.Manifest) bool {
+	if manifest.Properties != nil {
+		return false
+	}
+	for _, group := range manifest.InstanceGroups {
+		if strings.HasPrefix(group.Name, opsManagerGroups[0]) {
+			return true
+		}
+	}
+	for _, job := range manifest.Jobs {
+		if strings.HasPrefix(job.Name, opsManagerGroups[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// withOpsManagerFallbacks completes the properties of a rep job in a
+// manifest generated by Ops Manager: what the rep's instance group lacks
+// is taken from the other Diego instance groups, and syslog_daemon_config
+// from any job that has it unless a syslog forwarder is colocated. Other
+// manifests are left alone.
+func withOpsManagerFallbacks(manifest models.Manifest, properties *models.Properties) *models.Properties {
+	if !isOpsManagerManifest(manifest) {
+		return properties
+	}
+
+	merged := &models.Properties{}
+	mergeProperties(merged, properties)
+	for _, prefix := range opsManagerGroups {
+		for _, group := range manifest.InstanceGroups {
+			if strings.HasPrefix(group.Name, prefix) {
+				for _, job := range group.Jobs {
+					mergeProperties(merged, job.Properties)
+				}
+			}
+		}
+		for _, job := range manifest.Jobs {
+			if strings.HasPrefix(job.Name, prefix) {
+				mergeProperties(merged, job.Properties)
+			}
+		}
+	}
+
+	if merged.Syslog == nil && merged.SyslogForwarder == nil {
+		for _, group := range manifest.InstanceGroups {
+			for _, job := range group.Jobs {
+				if merged.Syslog == nil && job.Properties != nil {
+					merged.Syslog = job.Properties.Syslog
+				}
+			}
+		}
+		for _, job := range manifest.Jobs {
+			if merged.Syslog == nil && job.Properties != nil {
+				merged.Syslog = job.Properties.Syslog
+			}
+		}
+	}
+	return merged
+}
+
+type zoneJob struct {
+	Zone string
+	Job  models.Job
+}
+
+// repJobsByZone returns the first rep job of every distinct zone, in
+// manifest order. Rep jobs without a zone are ignored.
+func repJobsByZone(manifest models.Manifest) []zoneJob {
+	zoneJobs := []zoneJob{}
+	seen := map[string]bool{}
+
+	for _, job := range allRepJobs(manifest) {
+		zone := repZone(job)
+		if zone == "" || seen[zone] {
+			continue
+		}
+		seen[zone] = true
+		zoneJobs = append(zoneJobs, zoneJob{Zone: zone, Job: job})
+	}
+
+	return zoneJobs
+}
+
+func repZone(job models.Job) string {
+	if job.Properties == nil || job.Properties.Diego == nil || job.Properties.Diego.Rep == nil {
+		return ""
+	}
+	return job.Properties.Diego.Rep.Zone
+}
+
+// manifestForZone narrows the manifest down to the rep job of the given
+// zone, falling back to the first rep job when no job matches.
+func manifestForZone(manifest models.Manifest, zoneJobs []zoneJob, zone string) models.Manifest {
+	for _, zoneJob := range zoneJobs {
+		if zoneJob.Zone == zone {
+			return manifestForRepJob(manifest, zoneJob.Job)
+		}
+	}
+	return manifest
+}
+
+// manifestForRepJob returns a copy of the manifest in which job is the only
+// rep job, so that the fill functions read the properties of that job.
+func manifestForRepJob(manifest models.Manifest, job models.Job) models.Manifest {
+	manifest.Jobs = []models.Job{job}
+	manifest.InstanceGroups = nil
+	return manifest
+}
+
+func isRepJob(job models.InstanceGroupJob) bool {
+	if job.Name == "rep" {
+		return true
+	}
+	return job.Properties != nil && job.Properties.Diego != nil && job.Properties.Diego.Rep != nil
+}
+
+// mergeInstanceGroupProperties combines the properties of all jobs in an
+// instance group. The rep job is consulted first, so its values win over
+// the ones defined on colocated jobs.
+func mergeInstanceGroupProperties(repJob models.InstanceGroupJob, jobs []models.InstanceGroupJob) *models.Properties {
+	merged := &models.Properties{}
+	mergeProperties(merged, repJob.Properties)
+	for _, job := range jobs {
+		mergeProperties(merged, job.Properties)
+	}
+	return merged
+}
+
+// mergeProperties fills what dst lacks with the properties of src, field by
+// field: a section set on one job, such as a loggregator block on the rep,
+// must not hide the settings other jobs keep in the same section, such as
+// metron_agent's loggregator.etcd.
+func mergeProperties(dst, src *models.Properties) {
+	if src == nil {
+		return
+	}
+	mergeValue(reflect.ValueOf(dst).Elem(), reflect.ValueOf(src).Elem())
+}
+
+// mergeValue sets the unset fields of dst to those of src. Structs behind
+// pointers are copied, so merging never changes the properties of a job.
+func mergeValue(dst, src reflect.Value) {
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		if dst.Type().Elem().Kind() != reflect.Struct {
+			// a set *bool, such as require_ssl: false, is kept
+			if dst.IsNil() {
+				dst.Set(src)
+			}
+			return
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		mergeValue(dst.Elem(), src.Elem())
+	case reflect.Struct:
+		for i := 0; i < dst.NumField(); i++ {
+			mergeValue(dst.Field(i), src.Field(i))
+		}
+	case reflect.Slice:
+		if dst.Len() == 0 {
+			dst.Set(src)
+		}
+	default:
+		if dst.IsZero() {
+			dst.Set(src)
+		}
+	}
+}
+
+func extractConsulKeyAndCert(properties *models.Properties, files *fileSet) error {
+	return extractFiles(properties, consulFiles, files)
+}
+
+func extractBbsKeyAndCert(properties *models.Properties, files *fileSet) error {
+	return extractFiles(properties, bbsFiles, files)
+}
+
+func extractMetronKeyAndCert(properties *models.Properties, files *fileSet) error {
+	return extractFiles(properties, metronFiles, files)
+}
+
+func extractEtcdKeyAndCert(loggregator *models.LoggregatorProperties, metronAgent *models.MetronAgent, files *fileSet) error {
+	// the etcd client certificate may come from the global properties
+	return extractFiles(&models.Properties{Loggregator: loggregator, MetronAgent: metronAgent}, etcdFiles, files)
+}
@@ -0,0 +1,64 @@
+package generator
+
+import (
+	"math"
+	"time"
+
+	"models"
+)
+
+// CertificateReport describes the certificates of the manifest that the
+// Windows cells depend on. Properties the manifest does not set are left
+// out.
+func CertificateReport(manifest models.Manifest, now time.Time) ([]models.CertificateInfo, error) {
+	report := []models.CertificateInfo{}
+
+	for _, reported := range reportedCertificates() {
+		properties, err := repOrGlobalProperties(manifest, func(p *models.Properties) bool {
+			return reported.Value(p) != ""
+		})
+		if err != nil {
+			return nil, err
+		}
+		if properties == nil {
+			continue
+		}
+
+		certs, err := parseCertificates(reported.Value(properties))
+		if err != nil {
+			return nil, &CertificateError{Path: reported.Path, Err: err}
+		}
+		cert := certs[0]
+
+		sans := []string{}
+		sans = append(sans, cert.DNSNames...)
+		for _, ip := range cert.IPAddresses {
+			sans = append(sans, ip.String())
+		}
+
+		report = append(report, models.CertificateInfo{
+			Property:        reported.Path,
+			Subject:         cert.Subject.String(),
+			SANs:            sans,
+			Issuer:          cert.Issuer.String(),
+			NotAfter:        cert.NotAfter,
+			DaysUntilExpiry: int(math.Floor(cert.NotAfter.Sub(now).Hours() / 24)),
+		})
+	}
+
+	return report, nil
+}
+
+// reportedCertificates are the certificates of the extraction tables, the
+// CAs and the certificates of the key pairs.
+func reportedCertificates() []manifestFile {
+	certs := []manifestFile{}
+	for _, table := range manifestTables {
+		for _, file := range table {
+			if file.Role == keyPairCA || file.Role == keyPairCert {
+				certs = append(certs, file)
+			}
+		}
+	}
+	return certs
+}
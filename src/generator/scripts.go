@@ -0,0 +1,124 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"text/template"
+
+	"models"
+)
+
+const (
+	installBatTemplate = `{{ if .SecretsFile }}@echo off
+setlocal
+if not exist %~dp0\install_secrets.bat (
+  echo %~dp0\install_secrets.bat is missing
+  exit /b 1
+)
+call %~dp0\install_secrets.bat
+del %~dp0\install_secrets.bat
+
+{{ end }}msiexec /passive /norestart /i %~dp0\DiegoWindows.msi ^{{ if .BbsRequireSsl }}
+  BBS_CA_FILE=%~dp0\bbs_ca.crt ^
+  BBS_CLIENT_CERT_FILE=%~dp0\bbs_client.crt ^
+  BBS_CLIENT_KEY_FILE=%~dp0\bbs_client.key ^{{ end }}
+  CONSUL_IPS={{.ConsulIPs}} ^
+  CF_ETCD_CLUSTER={{.EtcdCluster}} ^
+  STACK={{.Stack}} ^
+  REDUNDANCY_ZONE={{.Zone}} ^
+  LOGGREGATOR_SHARED_SECRET={{ if .SecretsFile }}%LOGGREGATOR_SHARED_SECRET%{{ else }}{{.SharedSecret}}{{ end }} ^
+  MACHINE_IP={{.MachineIp}}{{ if .SyslogHostIP }} ^
+  SYSLOG_HOST_IP={{.SyslogHostIP}} ^
+  SYSLOG_PORT={{.SyslogPort}}{{ end }}{{if .ConsulRequireSSL }} ^
+  CONSUL_ENCRYPT_FILE=%~dp0\consul_encrypt.key ^
+  CONSUL_CA_FILE=%~dp0\consul_ca.crt ^
+  CONSUL_AGENT_CERT_FILE=%~dp0\consul_agent.crt ^
+  CONSUL_AGENT_KEY_FILE=%~dp0\consul_agent.key{{end}}{{if .MetronPreferTLS }} ^
+  METRON_CA_FILE=%~dp0\metron_ca.crt ^
+  METRON_AGENT_CERT_FILE=%~dp0\metron_agent.crt ^
+  METRON_AGENT_KEY_FILE=%~dp0\metron_agent.key{{end}}{{if .EtcdRequireSSL }} ^
+  ETCD_CA_FILE=%~dp0\etcd_ca.crt ^
+  ETCD_CERT_FILE=%~dp0\etcd_client.crt ^
+  ETCD_KEY_FILE=%~dp0\etcd_client.key{{end}}{{ if .InstallGardenWindows }}
+
+msiexec /passive /norestart /i %~dp0\GardenWindows.msi ^
+  ADMIN_USERNAME={{.Username}} ^
+  ADMIN_PASSWORD={{ if .SecretsFile }}"""%ADMIN_PASSWORD%"""{{ else }}{{.Password}}{{ end }} ^
+  MACHINE_IP={{.MachineIp}}{{ if .SyslogHostIP }} ^
+  SYSLOG_HOST_IP={{.SyslogHostIP}} ^
+  SYSLOG_PORT={{.SyslogPort}}{{ end }}{{ end }}`
+
+	// set "NAME=value" quotes the raw values as a whole, a quote within the
+	// value would end it. install.bat quotes the password where it passes
+	// it to msiexec, as it does with an inline password.
+	installSecretsBatTemplate = `set "LOGGREGATOR_SHARED_SECRET={{.SharedSecret}}"{{ if .InstallGardenWindows }}
+set "ADMIN_PASSWORD={{.Password}}"{{ end }}`
+)
+
+func generateInstallScript(files *fileSet, args models.InstallerArguments) error {
+	batArgs := args
+	escapeWindowsPassword(&batArgs.Password)
+	batTemplate := template.Must(template.New("").Parse(installBatTemplate))
+	batScript, err := renderScript(batTemplate, batArgs)
+	if err != nil {
+		return err
+	}
+
+	ps1Template := template.Must(template.New("").Funcs(powershellFuncs).Parse(installPs1Template))
+	ps1Script, err := renderScript(ps1Template, args)
+	if err != nil {
+		return err
+	}
+
+	if !args.SecretsFile {
+		files.add("install.bat", batScript)
+		files.add("install.ps1", ps1Script)
+		return nil
+	}
+
+	files.addPublic("install.bat", batScript)
+	files.addPublic("install.ps1", ps1Script)
+
+	secretsBatTemplate := template.Must(template.New("").Parse(installSecretsBatTemplate))
+	secretsArgs := args
+	secretsArgs.SharedSecret = escapeBatchPercent(args.SharedSecret)
+	secretsArgs.Password = escapeBatchPercent(args.Password)
+	secretsBat, err := renderScript(secretsBatTemplate, secretsArgs)
+	if err != nil {
+		return err
+	}
+	files.add("install_secrets.bat", secretsBat)
+
+	secrets := map[string]string{"LOGGREGATOR_SHARED_SECRET": args.SharedSecret}
+	if args.InstallGardenWindows {
+		secrets["ADMIN_PASSWORD"] = args.Password
+	}
+	secretsJson, err := json.MarshalIndent(secrets, "", "  ")
+	if err != nil {
+		return err
+	}
+	files.add("install_secrets.json", string(secretsJson))
+	return nil
+}
+
+func renderScript(temp *template.Template, args interface{}) (string, error) {
+	buf := new(bytes.Buffer)
+	err := temp.Execute(buf, args)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Replace(buf.String(), "\n", "\r\n", -1), nil
+}
+
+func escapeWindowsPassword(password *string) {
+	newPassword := escapeBatchPercent(*password)
+	newPassword = "\"\"\"" + newPassword + "\"\"\""
+	*password = newPassword
+}
+
+// escapeBatchPercent keeps batch files from expanding the % of a value.
+func escapeBatchPercent(value string) string {
+	return strings.Replace(value, "%", "%%", -1)
+}
@@ -0,0 +1,123 @@
+package generator
+
+import (
+	"archive/zip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Sink receives the files of a bundle.
+type Sink interface {
+	WriteFile(file File) error
+}
+
+// DirectorySink writes the files below Dir, creating subdirectories as
+// needed. Directories are created with mode 0700, secret files are written
+// with mode 0600 and all other files with 0644.
+type DirectorySink struct {
+	Dir string
+}
+
+// NewDirectorySink creates dir, or checks that an existing dir is not
+// world-writable, where other users could replace the secrets written to
+// it. force skips the check.
+func NewDirectorySink(dir string, force bool) (*DirectorySink, error) {
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		err = os.MkdirAll(dir, 0700)
+		if err != nil {
+			return nil, &OutputError{Path: dir, Err: err}
+		}
+		return &DirectorySink{Dir: dir}, nil
+	}
+	if err != nil {
+		return nil, &OutputError{Path: dir, Err: err}
+	}
+
+	if !info.IsDir() {
+		return nil, &OutputError{Path: dir, Err: errors.New("not a directory")}
+	}
+	if info.Mode().Perm()&0002 != 0 && !force {
+		return nil, &OutputError{Path: dir, Err: errors.New("refusing to write secrets into a world-writable directory, use -force to override")}
+	}
+	return &DirectorySink{Dir: dir}, nil
+}
+
+func (s DirectorySink) WriteFile(file File) error {
+	filename := filepath.Join(s.Dir, filepath.FromSlash(file.Path))
+	err := os.MkdirAll(filepath.Dir(filename), 0700)
+	if err != nil {
+		return &OutputError{Path: filepath.Dir(filename), Err: err}
+	}
+
+	mode := os.FileMode(0644)
+	if file.Secret {
+		mode = 0600
+	}
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return &OutputError{Path: filename, Err: err}
+	}
+	defer f.Close()
+
+	// the mode of an existing file is kept by OpenFile
+	err = f.Chmod(mode)
+	if err != nil {
+		return &OutputError{Path: filename, Err: err}
+	}
+
+	_, err = f.Write(file.Content)
+	if err != nil {
+		return &OutputError{Path: filename, Err: err}
+	}
+	return f.Close()
+}
+
+// MemorySink keeps the files in memory, keyed by their path in the bundle.
+type MemorySink map[string][]byte
+
+func (s MemorySink) WriteFile(file File) error {
+	s[file.Path] = file.Content
+	return nil
+}
+
+// ZipSink writes the files into a zip archive, Close must be called to
+// complete it.
+type ZipSink struct {
+	writer *zip.Writer
+}
+
+func NewZipSink(w io.Writer) *ZipSink {
+	return &ZipSink{writer: zip.NewWriter(w)}
+}
+
+func (s *ZipSink) WriteFile(file File) error {
+	header := &zip.FileHeader{
+		Name:     file.Path,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	}
+	header.SetMode(0644)
+	if file.Secret {
+		header.SetMode(0600)
+	}
+
+	w, err := s.writer.CreateHeader(header)
+	if err != nil {
+		return &OutputError{Path: file.Path, Err: err}
+	}
+
+	_, err = w.Write(file.Content)
+	if err != nil {
+		return &OutputError{Path: file.Path, Err: err}
+	}
+	return nil
+}
+
+func (s *ZipSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,286 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"models"
+)
+
+// Source provides the deployment manifest to generate the scripts from.
+type Source interface {
+	Manifest(ctx context.Context) ([]byte, error)
+}
+
+// Director is implemented by sources that fetch the manifest from a BOSH
+// director, the name of which namespaces the deployment's CredHub variables.
+type Director interface {
+	DirectorName() string
+}
+
+// FileSource reads the manifest from a file, e.g. one downloaded with
+// bosh manifest.
+type FileSource struct {
+	Path string
+}
+
+func (s FileSource) Manifest(ctx context.Context) ([]byte, error) {
+	content, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return nil, &UsageError{fmt.Sprintf("Could not read manifest file: %v", err)}
+	}
+	return content, nil
+}
+
+// ReaderSource reads the manifest from a reader such as stdin.
+type ReaderSource struct {
+	Reader io.Reader
+}
+
+func (s ReaderSource) Manifest(ctx context.Context) ([]byte, error) {
+	content, err := ioutil.ReadAll(s.Reader)
+	if err != nil {
+		return nil, &UsageError{fmt.Sprintf("Could not read manifest: %v", err)}
+	}
+	return content, nil
+}
+
+// DirectorSource fetches the manifest of the Diego deployment from a BOSH
+// director. The deployment is detected with Filter unless Deployment names
+// it. A nil HTTPClient verifies the director against the system roots.
+type DirectorSource struct {
+	HTTPClient   *http.Client
+	URL          string
+	ClientID     string
+	ClientSecret string
+	Deployment   string
+	Filter       DeploymentFilter
+
+	directorName string
+}
+
+func (s *DirectorSource) Manifest(ctx context.Context) ([]byte, error) {
+	info, err := fetchDirectorInfo(ctx, s.HTTPClient, s.URL)
+	if err != nil {
+		return nil, err
+	}
+	s.directorName = info.Name
+
+	directorUrl, uaa, err := directorAuthentication(s.HTTPClient, s.URL, info, s.ClientID, s.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := fetchManifest(ctx, s.HTTPClient, directorUrl, uaa, s.Deployment, s.Filter)
+	return []byte(manifest), err
+}
+
+// DirectorName returns the name reported by the director, it is only known
+// once the manifest has been fetched.
+func (s *DirectorSource) DirectorName() string {
+	return s.directorName
+}
+
+func fetchDirectorInfo(ctx context.Context, client *http.Client, boshServerUrl string) (models.DirectorInfo, error) {
+	info := models.DirectorInfo{}
+
+	response, err := newBoshRequest(ctx, client, boshServerUrl+"/info", nil)
+	if err != nil {
+		return info, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusOK {
+		json.NewDecoder(response.Body).Decode(&info)
+	}
+	return info, nil
+}
+
+// directorAuthentication decides how to authenticate with the director. For
+// UAA-backed directors it returns the director URL without any embedded
+// credentials, together with a UAA client that obtains bearer tokens using
+// either the client credentials or the username and password from the URL.
+func directorAuthentication(client *http.Client, boshServerUrl string, info models.DirectorInfo, clientID, clientSecret string) (string, *UAAClient, error) {
+	if info.UserAuthentication.Type != "uaa" {
+		return boshServerUrl, nil, nil
+	}
+
+	directorUrl, err := url.Parse(boshServerUrl)
+	if err != nil {
+		return "", nil, &UsageError{fmt.Sprintf("Invalid boshUrl. %s", err)}
+	}
+
+	var username, password string
+	if directorUrl.User != nil {
+		username = directorUrl.User.Username()
+		password, _ = directorUrl.User.Password()
+		directorUrl.User = nil
+	}
+
+	if clientID == "" && username == "" {
+		return "", nil, &AuthenticationError{
+			Target: "BOSH Director",
+			Err:    errors.New("BOSH Director uses UAA authentication, provide -boshClient and -boshClientSecret or credentials in -boshUrl"),
+		}
+	}
+
+	if clientID != "" {
+		username, password = "", ""
+	}
+
+	uaa := NewUAAClient(client, info.UserAuthentication.Options.URL, clientID, clientSecret, username, password)
+	return directorUrl.String(), uaa, nil
+}
+
+func fetchManifest(ctx context.Context, client *http.Client, boshServerUrl string, uaa *UAAClient, deploymentName string, filter DeploymentFilter) (string, error) {
+	if deploymentName == "" {
+		var err error
+		deploymentName, err = findDiegoDeployment(ctx, client, boshServerUrl, uaa, filter)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	response, err := newBoshRequest(ctx, client, boshServerUrl+"/deployments/"+url.PathEscape(deploymentName), uaa)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	err = checkDirectorResponse(response)
+	if err != nil {
+		return "", err
+	}
+
+	deployment := models.ShowDeployment{}
+	json.NewDecoder(response.Body).Decode(&deployment)
+	return deployment.Manifest, nil
+}
+
+func findDiegoDeployment(ctx context.Context, client *http.Client, boshServerUrl string, uaa *UAAClient, filter DeploymentFilter) (string, error) {
+	response, err := newBoshRequest(ctx, client, boshServerUrl+"/deployments", uaa)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	err = checkDirectorResponse(response)
+	if err != nil {
+		return "", err
+	}
+
+	deployments := []models.IndexDeployment{}
+	json.NewDecoder(response.Body).Decode(&deployments)
+	idx, candidates := GetDiegoDeployment(deployments, filter)
+	if idx == -1 {
+		names := []string{}
+		for _, deployment := range deployments {
+			names = append(names, deployment.Name)
+		}
+		return "", &DeploymentError{Candidates: candidates, Deployments: names}
+	}
+
+	return deployments[idx].Name, nil
+}
+
+func checkDirectorResponse(response *http.Response) error {
+	if response.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	buf := new(bytes.Buffer)
+	_, err := buf.ReadFrom(response.Body)
+	if err != nil {
+		return &UnreachableError{Target: "BOSH Director", Err: fmt.Errorf("Could not read response from BOSH director. %s", err)}
+	}
+
+	return &DirectorResponseError{StatusCode: response.StatusCode, Body: buf.String()}
+}
+
+// DeploymentFilter describes which deployment on the director is the Diego
+// deployment. Every entry of RequiredReleases lists release names of which at
+// least one must be part of the deployment, e.g. garden-linux or garden-runc.
+type DeploymentFilter struct {
+	RequiredReleases [][]string
+	NamePattern      *regexp.Regexp
+}
+
+const DefaultRequiredReleases = "cf,diego,garden-linux|garden-runc"
+
+func NewDeploymentFilter(requiredReleases, namePattern string) (DeploymentFilter, error) {
+	filter := DeploymentFilter{}
+
+	for _, release := range strings.Split(requiredReleases, ",") {
+		release = strings.TrimSpace(release)
+		if release == "" {
+			continue
+		}
+		filter.RequiredReleases = append(filter.RequiredReleases, strings.Split(release, "|"))
+	}
+
+	if namePattern != "" {
+		pattern, err := regexp.Compile(namePattern)
+		if err != nil {
+			return filter, &UsageError{fmt.Sprintf("Invalid deploymentPattern. %s", err)}
+		}
+		filter.NamePattern = pattern
+	}
+
+	return filter, nil
+}
+
+func (f DeploymentFilter) Matches(deployment models.IndexDeployment) bool {
+	if f.NamePattern != nil && !f.NamePattern.MatchString(deployment.Name) {
+		return false
+	}
+
+	releases := map[string]bool{}
+	for _, rel := range deployment.Releases {
+		releases[rel.Name] = true
+	}
+
+	for _, alternatives := range f.RequiredReleases {
+		found := false
+		for _, name := range alternatives {
+			if releases[name] {
+				found = true
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetDiegoDeployment returns the index of the only deployment matching the
+// filter, or -1 if there is none or more than one. The names of all matching
+// deployments are returned as well so that callers can report them.
+func GetDiegoDeployment(deployments []models.IndexDeployment, filter DeploymentFilter) (int, []string) {
+	deploymentIndex := -1
+	candidates := []string{}
+
+	for i, deployment := range deployments {
+		if filter.Matches(deployment) {
+			candidates = append(candidates, deployment.Name)
+			deploymentIndex = i
+		}
+	}
+
+	if len(candidates) != 1 {
+		return -1, candidates
+	}
+
+	return deploymentIndex, candidates
+}
@@ -0,0 +1,128 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"models"
+)
+
+const (
+	// bosh_cli is the public UAA client the BOSH CLI uses for password grants.
+	uaaPasswordGrantClient = "bosh_cli"
+
+	// tokens are refreshed slightly before they expire so that a request
+	// does not race the expiry on the director side.
+	uaaTokenExpiryMargin = 30 * time.Second
+)
+
+type UAAClient struct {
+	HTTPClient   *http.Client
+	URL          string
+	ClientID     string
+	ClientSecret string
+	Username     string
+	Password     string
+
+	token     *models.UAAToken
+	expiresAt time.Time
+}
+
+func NewUAAClient(httpClient *http.Client, uaaUrl, clientID, clientSecret, username, password string) *UAAClient {
+	client := &UAAClient{
+		HTTPClient:   httpClient,
+		URL:          strings.TrimSuffix(uaaUrl, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Username:     username,
+		Password:     password,
+	}
+
+	if client.ClientID == "" {
+		client.ClientID = uaaPasswordGrantClient
+	}
+	return client
+}
+
+// AccessToken returns the bearer token to send to the director, fetching a
+// new one on first use and refreshing it once it is about to expire.
+func (c *UAAClient) AccessToken() (string, error) {
+	if c.token == nil {
+		return c.requestToken(c.grantParams())
+	}
+
+	if time.Now().Add(uaaTokenExpiryMargin).Before(c.expiresAt) {
+		return c.token.AccessToken, nil
+	}
+
+	if c.token.RefreshToken == "" {
+		return c.requestToken(c.grantParams())
+	}
+
+	token, err := c.requestToken(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {c.token.RefreshToken},
+	})
+	if err != nil {
+		// the refresh token may have been revoked or expired as well
+		return c.requestToken(c.grantParams())
+	}
+	return token, nil
+}
+
+func (c *UAAClient) grantParams() url.Values {
+	if c.Username != "" {
+		return url.Values{
+			"grant_type": {"password"},
+			"username":   {c.Username},
+			"password":   {c.Password},
+		}
+	}
+
+	return url.Values{
+		"grant_type": {"client_credentials"},
+	}
+}
+
+func (c *UAAClient) requestToken(params url.Values) (string, error) {
+	request, err := http.NewRequest("POST", c.URL+"/oauth/token", strings.NewReader(params.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(c.ClientID, c.ClientSecret)
+
+	response, err := httpClientOrDefault(c.HTTPClient).Do(request)
+	if err != nil {
+		return "", &UnreachableError{Target: "UAA", Err: err}
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(response.Body)
+		return "", &AuthenticationError{
+			Target: "UAA",
+			Err:    fmt.Errorf("unexpected UAA response: %v, %v", response.StatusCode, buf.String()),
+		}
+	}
+
+	token := models.UAAToken{}
+	err = json.NewDecoder(response.Body).Decode(&token)
+	if err != nil {
+		return "", &UnreachableError{Target: "UAA", Err: fmt.Errorf("invalid UAA response: %v", err)}
+	}
+	if token.AccessToken == "" {
+		return "", &AuthenticationError{Target: "UAA", Err: fmt.Errorf("UAA response did not contain an access token")}
+	}
+
+	c.token = &token
+	c.expiresAt = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	return token.AccessToken, nil
+}
@@ -0,0 +1,118 @@
+package generator
+
+import (
+	"path"
+	"text/template"
+
+	"models"
+)
+
+// DefaultContainersDir is where GardenWindows keeps the containers of a
+// cell, removed by the uninstall scripts when asked to clean up.
+const DefaultContainersDir = `C:\containerizer`
+
+const (
+	// DiegoWindows' services talk to the containerizer set up by
+	// GardenWindows, so they are stopped and removed first. The products are
+	// found by name, there is no need to know their product codes.
+	uninstallBatTemplate = `@echo off
+setlocal
+
+for %%s in (RepService MetronService ConsulService{{ if .InstallGardenWindows }} ContainerizerService GardenWindowsService{{ end }}) do (
+  net stop %%s >nul 2>&1
+)
+
+wmic product where "name='DiegoWindows'" call uninstall /nointeractive{{ if .InstallGardenWindows }}
+wmic product where "name='GardenWindows'" call uninstall /nointeractive{{ end }}
+
+if /i not "%~1"=="/cleanup" exit /b 0
+{{ range .Files }}
+del /q "%~dp0\{{ . }}" 2>nul{{ end }}
+if exist "{{ .ContainersDir }}" rmdir /s /q "{{ .ContainersDir }}"`
+
+	uninstallPs1Template = `param(
+    # also remove the certificates and keys next to this script and the containers
+    [switch]$Cleanup
+)
+
+$ErrorActionPreference = "Stop"
+
+function Uninstall-Msi {
+    param(
+        [string]$Name
+    )
+
+    $keys = @(
+        'HKLM:\SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall',
+        'HKLM:\SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall'
+    )
+    $product = Get-ChildItem $keys -ErrorAction SilentlyContinue |
+        Get-ItemProperty |
+        Where-Object { $_.DisplayName -eq $Name } |
+        Select-Object -First 1
+    if ($product -eq $null) {
+        Write-Host "$Name is not installed"
+        return
+    }
+
+    $productCode = $product.PSChildName
+    $logPath = Join-Path $PSScriptRoot ("uninstall_" + $Name + ".log")
+    Write-Host "Uninstalling $Name $productCode, logging to $logPath"
+    $arguments = @("/passive", "/norestart", "/x", $productCode, "/liwe", """$logPath""")
+    $process = Start-Process -FilePath "msiexec.exe" -ArgumentList $arguments -Wait -PassThru
+
+    # 3010: the removal succeeded but a reboot is required
+    if ($process.ExitCode -ne 0 -and $process.ExitCode -ne 3010) {
+        $host.UI.WriteErrorLine("Uninstalling $Name failed with exit code $($process.ExitCode), see $logPath")
+        exit $process.ExitCode
+    }
+}
+
+foreach ($service in @('RepService', 'MetronService', 'ConsulService'{{ if .InstallGardenWindows }}, 'ContainerizerService', 'GardenWindowsService'{{ end }})) {
+    Stop-Service -Name $service -ErrorAction SilentlyContinue
+}
+
+Uninstall-Msi -Name "DiegoWindows"{{ if .InstallGardenWindows }}
+Uninstall-Msi -Name "GardenWindows"{{ end }}
+
+if ($Cleanup) {
+    foreach ($file in @({{ range $i, $file := .Files }}{{ if $i }}, {{ end }}{{ ps $file }}{{ end }})) {
+        Remove-Item -Force -ErrorAction SilentlyContinue (Join-Path $PSScriptRoot $file)
+    }
+    if (Test-Path {{ ps .ContainersDir }}) {
+        Remove-Item -Recurse -Force {{ ps .ContainersDir }}
+    }
+}`
+)
+
+// uninstallArguments are the installer arguments together with the files
+// taken from the manifest, which the uninstall scripts remove on cleanup.
+type uninstallArguments struct {
+	models.InstallerArguments
+	Files []string
+}
+
+// generateUninstallScript adds the uninstall scripts, which contain no
+// secrets. It must be called before the install scripts are added, so
+// that the files so far are the certificates and keys of the manifest.
+func generateUninstallScript(files *fileSet, args models.InstallerArguments) error {
+	uninstallArgs := uninstallArguments{InstallerArguments: args}
+	for _, file := range files.files {
+		uninstallArgs.Files = append(uninstallArgs.Files, path.Base(file.Path))
+	}
+
+	for _, script := range []struct {
+		name string
+		tmpl *template.Template
+	}{
+		{"uninstall.bat", template.Must(template.New("").Parse(uninstallBatTemplate))},
+		{"uninstall.ps1", template.Must(template.New("").Funcs(powershellFuncs).Parse(uninstallPs1Template))},
+	} {
+		content, err := renderScript(script.tmpl, uninstallArgs)
+		if err != nil {
+			return err
+		}
+		files.add(script.name, content)
+	}
+	return nil
+}
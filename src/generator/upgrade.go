@@ -0,0 +1,337 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+
+	"models"
+)
+
+// digestPrefix marks parameters recorded by their SHA-256 only, secrets
+// and file contents. Their changes are reported without their values.
+const digestPrefix = "sha256:"
+
+// notRecorded replaces the shared secret and the admin password in the
+// bundle's install_params.json: a digest of a password can be guessed
+// offline. The upgrade script tells their changes by the install scripts
+// holding them instead.
+const notRecorded = "(not recorded)"
+
+var unrecordedParameters = []string{"LOGGREGATOR_SHARED_SECRET", "ADMIN_PASSWORD"}
+
+const (
+	upgradeBatTemplate = `@echo off
+powershell.exe -NoProfile -ExecutionPolicy Bypass -File "%~dp0\upgrade.ps1" %*
+exit /b %ERRORLEVEL%`
+
+	// The parameters of the last installation are kept outside of the
+	// script directory, which is replaced by every new release. Digests are
+	// recorded as HMACs keyed with a random key of the cell, so that the
+	// record cannot be used to guess the secrets, and only Administrators
+	// and SYSTEM may read the record and its key.
+	upgradePs1Template = `$ErrorActionPreference = "Stop"
+
+$recordDir = Join-Path $env:ProgramData 'DiegoWindows'
+$recordPath = Join-Path $recordDir 'install_params.json'
+$keyPath = Join-Path $recordDir 'install_params.key'
+
+function Read-Parameters {
+    param(
+        [string]$Path
+    )
+
+    $parameters = @{}
+    $json = Get-Content -Raw $Path | ConvertFrom-Json
+    foreach ($property in $json.PSObject.Properties) {
+        $parameters[$property.Name] = [string]$property.Value
+    }
+    return $parameters
+}
+
+function Protect-Value {
+    param(
+        [string]$Value,
+        [byte[]]$Key
+    )
+
+    if (-not $Value.StartsWith('{{ .DigestPrefix }}')) {
+        return $Value
+    }
+    $hmac = New-Object System.Security.Cryptography.HMACSHA256 (,$Key)
+    $mac = $hmac.ComputeHash([System.Text.Encoding]::UTF8.GetBytes($Value))
+    return 'hmac-sha256:' + [System.BitConverter]::ToString($mac).Replace('-', '').ToLower()
+}
+
+function Protect-Path {
+    param(
+        [string]$Path,
+        [string]$Inheritance
+    )
+
+    # Administrators and SYSTEM, by SID to work with any display language
+    icacls $Path /inheritance:r /grant:r "*S-1-5-32-544:${Inheritance}F" "*S-1-5-18:${Inheritance}F" | Out-Null
+    if ($LASTEXITCODE) {
+        throw "Could not restrict the access to $Path"
+    }
+}
+
+function Format-Value {
+    param(
+        [string]$Value
+    )
+
+    if ($Value.StartsWith('hmac-sha256:')) {
+        return '(secret)'
+    }
+    return $Value
+}
+
+if ((Test-Path $recordPath) -and (Test-Path $keyPath)) {
+    $key = [System.Convert]::FromBase64String((Get-Content -Raw $keyPath).Trim())
+    $previous = Read-Parameters $recordPath
+} else {
+    Write-Host "No parameters recorded at $recordPath, reinstalling"
+    $key = New-Object byte[] 32
+    [System.Security.Cryptography.RandomNumberGenerator]::Create().GetBytes($key)
+    $previous = @{}
+}
+
+# the bundle records neither the shared secret nor the admin password, the
+# install script{{ if .SecretsFile }} and the secrets file{{ end }} holding them are compared instead
+$parameters = Read-Parameters (Join-Path $PSScriptRoot 'install_params.json')
+foreach ($file in @('DiegoWindows.msi'{{ if .InstallGardenWindows }}, 'GardenWindows.msi'{{ end }}, 'install.ps1'{{ if .SecretsFile }}, 'install_secrets.json'{{ end }})) {
+    $filePath = Join-Path $PSScriptRoot $file
+    if (Test-Path $filePath) {
+        $parameters[$file] = '{{ .DigestPrefix }}' + (Get-FileHash -Algorithm SHA256 $filePath).Hash.ToLower()
+    } elseif ($file -eq 'install_secrets.json' -and $previous.ContainsKey($file)) {
+        # install.ps1 removes the secrets file, its recorded HMAC stands until
+        # a new one is copied next to the script
+        $parameters[$file] = $previous[$file]
+    }
+}
+
+$protected = @{}
+foreach ($name in $parameters.Keys) {
+    $protected[$name] = Protect-Value $parameters[$name] $key
+}
+
+$changes = @()
+foreach ($name in (@($protected.Keys) + @($previous.Keys) | Sort-Object -Unique)) {
+    $old = $previous[$name]
+    $new = $protected[$name]
+    if ($old -eq $new) {
+        continue
+    }
+    if ($old -eq $null) {
+        $changes += "${name}: added $(Format-Value $new)"
+    } elseif ($new -eq $null) {
+        $changes += "${name}: removed $(Format-Value $old)"
+    } elseif ($new.StartsWith('hmac-sha256:')) {
+        $changes += "${name}: changed"
+    } else {
+        $changes += "${name}: $old -> $new"
+    }
+}
+
+if ($changes.Count -eq 0) {
+    Write-Host "The installation is up to date"
+    exit 0
+}
+
+Write-Host "Reinstalling, the following changed:"
+foreach ($change in $changes) {
+    Write-Host "  $change"
+}
+
+& (Join-Path $PSScriptRoot 'uninstall.ps1')
+if ($LASTEXITCODE) {
+    exit $LASTEXITCODE
+}
+& (Join-Path $PSScriptRoot 'install.ps1')
+if ($LASTEXITCODE) {
+    exit $LASTEXITCODE
+}
+
+New-Item -ItemType Directory -Force $recordDir | Out-Null
+Protect-Path $recordDir '(OI)(CI)'
+Set-Content $keyPath ([System.Convert]::ToBase64String($key))
+$protected | ConvertTo-Json | Set-Content $recordPath
+Protect-Path $keyPath ''
+Protect-Path $recordPath ''`
+)
+
+// upgradeArguments adds the digest marker to the installer arguments.
+type upgradeArguments struct {
+	models.InstallerArguments
+	DigestPrefix string
+}
+
+// installParameters returns the parameters of an installation that require
+// a reinstall when they change: the MSI properties and the contents of the
+// files taken from the manifest. Certificates are recorded by their
+// fingerprints, secrets and other files by their digest.
+func installParameters(args models.InstallerArguments, files []File) map[string]string {
+	parameters := map[string]string{
+		"CONSUL_IPS":                args.ConsulIPs,
+		"CF_ETCD_CLUSTER":           args.EtcdCluster,
+		"STACK":                     args.Stack,
+		"REDUNDANCY_ZONE":           args.Zone,
+		"MACHINE_IP":                args.MachineIp,
+		"LOGGREGATOR_SHARED_SECRET": digest([]byte(args.SharedSecret)),
+	}
+	if args.SyslogHostIP != "" {
+		parameters["SYSLOG_HOST_IP"] = args.SyslogHostIP
+		parameters["SYSLOG_PORT"] = args.SyslogPort
+	}
+	if args.InstallGardenWindows {
+		parameters["ADMIN_USERNAME"] = args.Username
+		parameters["ADMIN_PASSWORD"] = digest([]byte(args.Password))
+	}
+	for _, file := range files {
+		parameters[path.Base(file.Path)] = fileParameter(file)
+	}
+	return parameters
+}
+
+func fileParameter(file File) string {
+	if file.Secret {
+		return digest(file.Content)
+	}
+	certs, err := parseCertificates(string(file.Content))
+	if err != nil {
+		return digest(file.Content)
+	}
+
+	fingerprints := []string{}
+	for _, cert := range certs {
+		fingerprints = append(fingerprints, fingerprint(cert))
+	}
+	return strings.Join(fingerprints, ",")
+}
+
+// fingerprint is the SHA-256 fingerprint of cert, in the format of openssl
+// x509 -fingerprint.
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	bytes := []string{}
+	for _, b := range sum {
+		bytes = append(bytes, fmt.Sprintf("%02X", b))
+	}
+	return strings.Join(bytes, ":")
+}
+
+func digest(content []byte) string {
+	sum := sha256.Sum256(content)
+	return digestPrefix + hex.EncodeToString(sum[:])
+}
+
+// generateUpgradeScript adds the parameters of the installation and the
+// upgrade scripts, which reinstall only when the parameters or the MSIs
+// differ from those of the last installation. manifestFiles are the
+// certificates and keys taken from the manifest.
+func generateUpgradeScript(files *fileSet, args models.InstallerArguments, manifestFiles []File) (map[string]string, error) {
+	parameters := installParameters(args, manifestFiles)
+	content, err := json.MarshalIndent(recordedParameters(parameters), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	upgradeArgs := upgradeArguments{InstallerArguments: args, DigestPrefix: digestPrefix}
+	for _, script := range []struct {
+		name string
+		tmpl *template.Template
+	}{
+		{"upgrade.bat", template.Must(template.New("").Parse(upgradeBatTemplate))},
+		{"upgrade.ps1", template.Must(template.New("").Parse(upgradePs1Template))},
+	} {
+		rendered, err := renderScript(script.tmpl, upgradeArgs)
+		if err != nil {
+			return nil, err
+		}
+		files.add(script.name, rendered)
+	}
+
+	files.add("install_params.json", string(content))
+	return parameters, nil
+}
+
+// recordedParameters returns the parameters as written to the bundle,
+// without the digests of the passwords.
+func recordedParameters(parameters map[string]string) map[string]string {
+	recorded := map[string]string{}
+	for name, value := range parameters {
+		recorded[name] = value
+	}
+	for _, name := range unrecordedParameters {
+		if _, ok := recorded[name]; ok {
+			recorded[name] = notRecorded
+		}
+	}
+	return recorded
+}
+
+// LoadInstallParameters reads the install_params.json of an earlier
+// bundle.
+func LoadInstallParameters(filename string) (map[string]string, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, &UsageError{fmt.Sprintf("Could not read install parameters: %v", err)}
+	}
+
+	parameters := map[string]string{}
+	err = json.Unmarshal(content, &parameters)
+	if err != nil {
+		return nil, &UsageError{fmt.Sprintf("Invalid install parameters %s: %v", filename, err)}
+	}
+	return parameters, nil
+}
+
+// DiffInstallParameters describes the changes from previous to current,
+// one line per parameter in alphabetical order. Secrets and files are only
+// reported as changed, parameters not recorded on either side not at all.
+func DiffInstallParameters(previous, current map[string]string) []string {
+	names := []string{}
+	for name := range previous {
+		names = append(names, name)
+	}
+	for name := range current {
+		if _, ok := previous[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []string{}
+	for _, name := range names {
+		old, hadOld := previous[name]
+		new, hasNew := current[name]
+		switch {
+		case old == new && hadOld == hasNew:
+		case hadOld && hasNew && (old == notRecorded || new == notRecorded):
+		case !hadOld:
+			changes = append(changes, fmt.Sprintf("%s: added %s", name, formatParameter(new)))
+		case !hasNew:
+			changes = append(changes, fmt.Sprintf("%s: removed %s", name, formatParameter(old)))
+		case strings.HasPrefix(new, digestPrefix):
+			changes = append(changes, fmt.Sprintf("%s: changed", name))
+		default:
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", name, old, new))
+		}
+	}
+	return changes
+}
+
+func formatParameter(value string) string {
+	if strings.HasPrefix(value, digestPrefix) || value == notRecorded {
+		return "(secret)"
+	}
+	return value
+}
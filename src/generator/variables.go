@@ -0,0 +1,293 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/candiedyaml"
+
+	"models"
+)
+
+var variablePattern = regexp.MustCompile(`\(\(([^()\s]+)\)\)`)
+
+// VariableSource provides values for ((variable)) placeholders in a manifest.
+type VariableSource interface {
+	Get(name string) (interface{}, bool, error)
+}
+
+// StaticVariables holds variables from a vars store or the command line.
+type StaticVariables map[string]interface{}
+
+func (v StaticVariables) Get(name string) (interface{}, bool, error) {
+	value, ok := v[strings.TrimPrefix(name, "/")]
+	return value, ok, nil
+}
+
+func LoadVarsStore(varsStorePath string) (StaticVariables, error) {
+	content, err := ioutil.ReadFile(varsStorePath)
+	if err != nil {
+		return nil, err
+	}
+
+	variables := StaticVariables{}
+	err = candiedyaml.Unmarshal(content, &variables)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vars store %s: %s", varsStorePath, err)
+	}
+	return variables, nil
+}
+
+type interpolator struct {
+	sources []VariableSource
+	values  map[string]interface{}
+	missing map[string]bool
+}
+
+// InterpolateManifest decodes manifestYaml after replacing its ((variable))
+// placeholders, so that they may also stand for booleans, numbers and
+// lists. Placeholders such as ((bbs_client.ca)) select a field of a
+// structured variable, e.g. the ca of a certificate. Only the properties
+// known to models.Manifest are interpolated, so unrelated variables of the
+// deployment never need to be resolvable.
+func InterpolateManifest(manifestYaml []byte, sources []VariableSource) (models.Manifest, error) {
+	manifest := models.Manifest{}
+
+	var tree interface{}
+	err := candiedyaml.Unmarshal(manifestYaml, &tree)
+	if err != nil {
+		return manifest, &InvalidManifestError{err}
+	}
+	manifestType := reflect.TypeOf(manifest)
+	tree = knownProperties(tree, manifestType)
+
+	i := &interpolator{
+		sources: sources,
+		values:  map[string]interface{}{},
+		missing: map[string]bool{},
+	}
+
+	tree, err = i.interpolate(tree)
+	if err != nil {
+		return manifest, err
+	}
+
+	if len(i.missing) > 0 {
+		names := []string{}
+		for name := range i.missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return manifest, &InvalidManifestError{fmt.Errorf("Could not resolve manifest variables: %s", strings.Join(names, ", "))}
+	}
+
+	content, err := candiedyaml.Marshal(coerceScalars(tree, manifestType))
+	if err != nil {
+		return manifest, err
+	}
+
+	err = candiedyaml.NewDecoder(bytes.NewBuffer(content)).Decode(&manifest)
+	if err != nil {
+		return manifest, &InvalidManifestError{err}
+	}
+	return manifest, nil
+}
+
+// knownProperties returns the parts of a YAML node that decode into t.
+func knownProperties(node interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		fields, ok := node.(map[interface{}]interface{})
+		if !ok {
+			return node
+		}
+		known := map[interface{}]interface{}{}
+		for idx := 0; idx < t.NumField(); idx++ {
+			field := t.Field(idx)
+			name := yamlName(field)
+			if value, ok := fields[name]; ok && name != "-" {
+				known[name] = knownProperties(value, field.Type)
+			}
+		}
+		return known
+	case reflect.Slice:
+		items, ok := node.([]interface{})
+		if !ok {
+			return node
+		}
+		known := make([]interface{}, len(items))
+		for idx, item := range items {
+			known[idx] = knownProperties(item, t.Elem())
+		}
+		return known
+	}
+	return node
+}
+
+// coerceScalars parses the strings of a YAML node that decode into
+// booleans or numbers of t, as variables given with -v are strings.
+func coerceScalars(node interface{}, t reflect.Type) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch typed := node.(type) {
+	case map[interface{}]interface{}:
+		if t.Kind() == reflect.Struct {
+			for idx := 0; idx < t.NumField(); idx++ {
+				field := t.Field(idx)
+				name := yamlName(field)
+				if value, ok := typed[name]; ok {
+					typed[name] = coerceScalars(value, field.Type)
+				}
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice {
+			for idx, item := range typed {
+				typed[idx] = coerceScalars(item, t.Elem())
+			}
+		}
+	case string:
+		switch t.Kind() {
+		case reflect.Bool:
+			if value, err := strconv.ParseBool(typed); err == nil {
+				return value
+			}
+		case reflect.Int:
+			if value, err := strconv.Atoi(typed); err == nil {
+				return value
+			}
+		}
+	}
+	return node
+}
+
+func yamlName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+func (i *interpolator) interpolate(node interface{}) (interface{}, error) {
+	switch typed := node.(type) {
+	case map[interface{}]interface{}:
+		for key, value := range typed {
+			interpolated, err := i.interpolate(value)
+			if err != nil {
+				return nil, err
+			}
+			typed[key] = interpolated
+		}
+	case []interface{}:
+		for idx, value := range typed {
+			interpolated, err := i.interpolate(value)
+			if err != nil {
+				return nil, err
+			}
+			typed[idx] = interpolated
+		}
+	case string:
+		return i.interpolateString(typed)
+	}
+	return node, nil
+}
+
+func (i *interpolator) interpolateString(str string) (interface{}, error) {
+	matches := variablePattern.FindAllStringSubmatchIndex(str, -1)
+	if len(matches) == 0 {
+		return str, nil
+	}
+
+	// a value consisting of a single placeholder keeps the variable's type
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(str) {
+		value, found, err := i.resolve(str[matches[0][2]:matches[0][3]])
+		if err != nil || !found {
+			return str, err
+		}
+		return value, nil
+	}
+
+	var resolveErr error
+	result := variablePattern.ReplaceAllStringFunc(str, func(placeholder string) string {
+		value, found, err := i.resolve(placeholder[2 : len(placeholder)-2])
+		if err != nil {
+			resolveErr = err
+		}
+		if err != nil || !found {
+			return placeholder
+		}
+		return fmt.Sprint(value)
+	})
+	return result, resolveErr
+}
+
+func (i *interpolator) resolve(expression string) (interface{}, bool, error) {
+	fields := strings.Split(expression, ".")
+	name := fields[0]
+
+	value, found := i.values[name]
+	if !found && !i.missing[name] {
+		for _, source := range i.sources {
+			var err error
+			value, found, err = source.Get(name)
+			if err != nil {
+				return nil, false, &variableError{Name: name, Err: err}
+			}
+			if found {
+				i.values[name] = value
+				break
+			}
+		}
+	}
+
+	if !found {
+		i.missing[name] = true
+		return nil, false, nil
+	}
+
+	for _, field := range fields[1:] {
+		switch typed := value.(type) {
+		case map[interface{}]interface{}:
+			value, found = typed[field]
+		case map[string]interface{}:
+			value, found = typed[field]
+		default:
+			found = false
+		}
+
+		if !found {
+			i.missing[expression] = true
+			return nil, false, nil
+		}
+	}
+
+	return value, true, nil
+}
+
+// variableError is returned when a variable source fails, it keeps the exit
+// code of the underlying error.
+type variableError struct {
+	Name string
+	Err  error
+}
+
+func (e *variableError) Error() string {
+	return fmt.Sprintf("Could not fetch manifest variable %s: %s", e.Name, e.Err)
+}
+
+func (e *variableError) ExitCode() int {
+	return ExitCode(e.Err)
+}
@@ -0,0 +1,105 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("Certificate report", func() {
+	var tmpDir, manifestPath string
+	var session *gexec.Session
+
+	UseTempDir(&tmpDir)
+
+	BeforeEach(func() {
+		now := time.Now()
+		ca := generateCert("ca", nil, now.Add(-time.Hour), now.Add(365*24*time.Hour+time.Hour))
+		consul := generateCert("consul.service.cf.internal", ca, now.Add(-time.Hour), now.Add(10*24*time.Hour+time.Hour))
+		bbs := generateCert("bbs.service.cf.internal", ca, now.Add(-time.Hour), now.Add(100*24*time.Hour+time.Hour))
+
+		tmpl := template.Must(template.New("").Funcs(template.FuncMap{
+			"yaml": func(value string) string {
+				return "|\n          " + strings.Replace(strings.TrimSpace(value), "\n", "\n          ", -1)
+			},
+		}).Parse(certsManifestTemplate))
+
+		manifestPath = path.Join(tmpDir, "manifest.yml")
+		file, err := os.Create(manifestPath)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tmpl.Execute(file, certsManifest{
+			ConsulCA: ca.CertPEM, ConsulCert: consul.CertPEM, ConsulKey: consul.KeyPEM,
+			BBSCA: ca.CertPEM, BBSCert: bbs.CertPEM, BBSKey: bbs.KeyPEM,
+		})).To(Succeed())
+		Expect(file.Close()).To(Succeed())
+	})
+
+	It("lists the certificates as a table", func() {
+		session = StartGeneratorWithArgs("certs-report", "-manifest", manifestPath, "-days", "5")
+		Eventually(session).Should(gexec.Exit(0))
+
+		Expect(session.Out).Should(gbytes.Say(`PROPERTY\s+SUBJECT\s+SANS\s+ISSUER\s+EXPIRES\s+DAYS`))
+		Expect(session.Out).Should(gbytes.Say(`consul.ca_cert\s+CN=ca\s+ca\s+CN=ca\s+\S+\s+365`))
+		Expect(session.Out).Should(gbytes.Say(`consul.agent_cert\s+CN=consul.service.cf.internal\s+consul.service.cf.internal\s+CN=ca\s+\S+\s+10`))
+		Expect(session.Out).Should(gbytes.Say(`diego.rep.bbs.ca_cert`))
+		Expect(session.Out).Should(gbytes.Say(`diego.rep.bbs.client_cert\s+CN=bbs.service.cf.internal`))
+	})
+
+	It("lists the certificates as JSON", func() {
+		session = StartGeneratorWithArgs("certs-report", "-manifest", manifestPath, "-format", "json", "-days", "5")
+		Eventually(session).Should(gexec.Exit(0))
+
+		report := []models.CertificateInfo{}
+		Expect(json.Unmarshal(session.Out.Contents(), &report)).To(Succeed())
+		Expect(report).To(HaveLen(4))
+		Expect(report[1].Property).To(Equal("consul.agent_cert"))
+		Expect(report[1].SANs).To(Equal([]string{"consul.service.cf.internal"}))
+		Expect(report[1].Issuer).To(Equal("CN=ca"))
+		Expect(report[1].DaysUntilExpiry).To(Equal(10))
+	})
+
+	It("lists the certificates of every component", func() {
+		now := time.Now()
+		ca := generateCert("loggregator-ca", nil, now.Add(-time.Hour), now.Add(200*24*time.Hour+time.Hour))
+		metron := generateCert("metron", ca, now.Add(-time.Hour), now.Add(50*24*time.Hour+time.Hour))
+		indent := func(pem string) string {
+			return "|\n        " + strings.Replace(strings.TrimSpace(pem), "\n", "\n        ", -1)
+		}
+
+		content, err := ioutil.ReadFile(manifestPath)
+		Expect(err).NotTo(HaveOccurred())
+		manifest := strings.Replace(string(content), "  loggregator:\n",
+			"  metron_agent:\n    tls_client:\n      cert: "+indent(metron.CertPEM)+"\n"+
+				"  loggregator:\n    tls:\n      ca: "+indent(ca.CertPEM)+"\n", 1)
+		Expect(ioutil.WriteFile(manifestPath, []byte(manifest), 0600)).To(Succeed())
+
+		session = StartGeneratorWithArgs("certs-report", "-manifest", manifestPath, "-days", "5")
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(session.Out).Should(gbytes.Say(`diego.rep.bbs.client_cert`))
+		Expect(session.Out).Should(gbytes.Say(`loggregator.tls.ca\s+CN=loggregator-ca\s+loggregator-ca\s+CN=loggregator-ca\s+\S+\s+200`))
+		Expect(session.Out).Should(gbytes.Say(`metron_agent.tls_client.cert\s+CN=metron\s+metron\s+CN=loggregator-ca\s+\S+\s+50`))
+	})
+
+	It("fails when a certificate expires within the window", func() {
+		session = StartGeneratorWithArgs("certs-report", "-manifest", manifestPath, "-days", "30")
+		Eventually(session).Should(gexec.Exit(7))
+		Expect(session.Err).Should(gbytes.Say("Certificates expiring within 30 days: consul.agent_cert"))
+	})
+
+	It("requires a manifest", func() {
+		session = StartGeneratorWithArgs("certs-report")
+		Eventually(session).Should(gexec.Exit(1))
+		Expect(session.Err).Should(gbytes.Say("Usage of generate certs-report:"))
+	})
+})
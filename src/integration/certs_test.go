@@ -0,0 +1,208 @@
+package integration_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *rsa.PrivateKey
+	CertPEM string
+	KeyPEM  string
+}
+
+func generateCert(name string, parent *testCert, notBefore, notAfter time.Time) *testCert {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	Expect(err).NotTo(HaveOccurred())
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+
+	issuer, issuerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		issuer, issuerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, issuerKey)
+	Expect(err).NotTo(HaveOccurred())
+	cert, err := x509.ParseCertificate(der)
+	Expect(err).NotTo(HaveOccurred())
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		CertPEM: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		KeyPEM:  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+	}
+}
+
+const certsManifestTemplate = `properties:
+  consul:
+    require_ssl: true
+    ca_cert: {{yaml .ConsulCA}}
+    agent_cert: {{yaml .ConsulCert}}
+    agent_key: {{yaml .ConsulKey}}
+    encrypt_keys:
+      - mBevws9TpU1sFPHK/Fq0IQ==
+    agent:
+      servers:
+        lan:
+          - 127.0.0.1
+  loggregator:
+    etcd:
+      machines:
+        - etcd1.foo.bar
+  metron_endpoint:
+    shared_secret: secret123
+  diego:
+    rep:
+      bbs:
+        require_ssl: true
+        ca_cert: {{yaml .BBSCA}}
+        client_cert: {{yaml .BBSCert}}
+        client_key: {{yaml .BBSKey}}
+
+jobs:
+  - properties:
+      diego:
+        rep:
+          zone: zone1
+`
+
+type certsManifest struct {
+	ConsulCA, ConsulCert, ConsulKey string
+	BBSCA, BBSCert, BBSKey          string
+}
+
+var _ = Describe("Certificate validation", func() {
+	var tmpDir, outputDir string
+	var manifest certsManifest
+	var session *gexec.Session
+	var ca, otherCA, consul, bbs *testCert
+
+	UseTempDir(&tmpDir)
+
+	BeforeEach(func() {
+		outputDir = path.Join(tmpDir, "output")
+
+		now := time.Now()
+		if ca == nil {
+			ca = generateCert("ca", nil, now.Add(-72*time.Hour), now.Add(24*time.Hour))
+			otherCA = generateCert("other-ca", nil, now.Add(-time.Hour), now.Add(24*time.Hour))
+			consul = generateCert("consul", ca, now.Add(-time.Hour), now.Add(24*time.Hour))
+			bbs = generateCert("bbs", ca, now.Add(-time.Hour), now.Add(24*time.Hour))
+		}
+
+		manifest = certsManifest{
+			ConsulCA: ca.CertPEM, ConsulCert: consul.CertPEM, ConsulKey: consul.KeyPEM,
+			BBSCA: ca.CertPEM, BBSCert: bbs.CertPEM, BBSKey: bbs.KeyPEM,
+		}
+	})
+
+	StartGenerator := func(extraArgs ...string) {
+		tmpl := template.Must(template.New("").Funcs(template.FuncMap{
+			"yaml": func(value string) string {
+				if value == "" {
+					return `""`
+				}
+				return "|\n          " + strings.Replace(strings.TrimSpace(value), "\n", "\n          ", -1)
+			},
+		}).Parse(certsManifestTemplate))
+
+		manifestFile, err := os.Create(path.Join(tmpDir, "manifest.yml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tmpl.Execute(manifestFile, manifest)).To(Succeed())
+		Expect(manifestFile.Close()).To(Succeed())
+
+		args := append([]string{
+			"-manifest", manifestFile.Name(),
+			"-outputDir", outputDir,
+			"-machineIp", "127.0.0.1",
+		}, extraArgs...)
+		session = StartGeneratorAsAdmin(args...)
+	}
+
+	It("accepts valid certificates", func() {
+		StartGenerator()
+		Eventually(session).Should(gexec.Exit(0))
+
+		content, err := ioutil.ReadFile(path.Join(outputDir, "bbs_client.crt"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.TrimSpace(string(content))).To(Equal(strings.TrimSpace(bbs.CertPEM)))
+	})
+
+	It("rejects an empty certificate", func() {
+		manifest.BBSCert = ""
+		StartGenerator()
+		Eventually(session).Should(gexec.Exit(5))
+		Expect(session.Err).Should(gbytes.Say("diego.rep.bbs.client_cert: certificate is empty"))
+	})
+
+	It("rejects a truncated certificate", func() {
+		manifest.BBSCert = bbs.CertPEM[:len(bbs.CertPEM)/2]
+		StartGenerator()
+		Eventually(session).Should(gexec.Exit(5))
+		Expect(session.Err).Should(gbytes.Say("diego.rep.bbs.client_cert: no PEM encoded certificate found"))
+	})
+
+	It("rejects a key that does not match the certificate", func() {
+		manifest.BBSKey = consul.KeyPEM
+		StartGenerator()
+		Eventually(session).Should(gexec.Exit(5))
+		Expect(session.Err).Should(gbytes.Say("diego.rep.bbs.client_key: private key does not match the certificate in diego.rep.bbs.client_cert"))
+	})
+
+	It("rejects a certificate signed by another CA", func() {
+		manifest.ConsulCA = otherCA.CertPEM
+		StartGenerator()
+		Eventually(session).Should(gexec.Exit(5))
+		Expect(session.Err).Should(gbytes.Say("consul.agent_cert: not signed by the CA in consul.ca_cert"))
+	})
+
+	Context("with an expired certificate", func() {
+		BeforeEach(func() {
+			expired := generateCert("consul", ca, time.Now().Add(-48*time.Hour), time.Now().Add(-24*time.Hour))
+			manifest.ConsulCert = expired.CertPEM
+			manifest.ConsulKey = expired.KeyPEM
+		})
+
+		It("fails", func() {
+			StartGenerator()
+			Eventually(session).Should(gexec.Exit(5))
+			Expect(session.Err).Should(gbytes.Say("consul.agent_cert: certificate expired on"))
+		})
+
+		It("only warns with -allowExpiredCerts", func() {
+			StartGenerator("-allowExpiredCerts")
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(session.Err).Should(gbytes.Say("WARNING: Invalid manifest property consul.agent_cert: certificate expired on"))
+		})
+	})
+})
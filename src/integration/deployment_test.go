@@ -0,0 +1,170 @@
+package integration_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	"github.com/onsi/gomega/ghttp"
+)
+
+func GardenRuncIndexDeployment() []models.IndexDeployment {
+	return []models.IndexDeployment{
+		{
+			Name: "cf",
+			Releases: []models.Release{
+				{Name: "cf", Version: "250"},
+			},
+		},
+		{
+			Name: "cf-warden-diego",
+			Releases: []models.Release{
+				{Name: "cf", Version: "250"},
+				{Name: "diego", Version: "1.5.0"},
+				{Name: "garden-runc", Version: "1.2.0"},
+			},
+		},
+	}
+}
+
+var _ = Describe("Choosing the Diego deployment", func() {
+	var outputDir string
+	var server *ghttp.Server
+	var session *gexec.Session
+
+	UseTempDir(&outputDir)
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	StartGenerator := func(extraArgs ...string) {
+		args := append([]string{
+			"-boshUrl", server.URL(),
+			"-outputDir", outputDir,
+			"-skipCertValidation",
+			"-machineIp", "127.0.0.1",
+		}, extraArgs...)
+		session = StartGeneratorAsAdmin(args...)
+	}
+
+	Context("with an explicit deployment name", func() {
+		BeforeEach(func() {
+			yaml, err := ioutil.ReadFile("syslog_manifest.yml")
+			Expect(err).ToNot(HaveOccurred())
+
+			server = ghttp.NewServer()
+			server.AppendHandlers(
+				BasicAuthInfoHandler(),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/deployments/my-diego"),
+					ghttp.RespondWithJSONEncoded(200, models.ShowDeployment{Manifest: string(yaml)}),
+				),
+			)
+
+			StartGenerator("-deployment", "my-diego")
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("does not list the deployments", func() {
+			Expect(server.ReceivedRequests()).To(HaveLen(2))
+		})
+
+		It("generates the install script", func() {
+			_, err := os.Stat(path.Join(outputDir, "install.bat"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when the explicit deployment does not exist", func() {
+		BeforeEach(func() {
+			server = ghttp.NewServer()
+			server.AppendHandlers(
+				BasicAuthInfoHandler(),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/deployments/missing"),
+					ghttp.RespondWith(404, "Deployment 'missing' doesn't exist"),
+				),
+			)
+
+			StartGenerator("-deployment", "missing")
+			Eventually(session).Should(gexec.Exit(4))
+		})
+
+		It("displays the director response", func() {
+			Expect(session.Err).Should(gbytes.Say("Deployment 'missing' doesn't exist"))
+		})
+	})
+
+	Context("when the deployment uses garden-runc", func() {
+		BeforeEach(func() {
+			server = CreateServer("syslog_manifest.yml", GardenRuncIndexDeployment())
+			StartGenerator()
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("detects the deployment", func() {
+			_, err := os.Stat(path.Join(outputDir, "install.bat"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("with custom required releases", func() {
+		BeforeEach(func() {
+			server = ghttp.NewServer()
+			server.AppendHandlers(
+				BasicAuthInfoHandler(),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/deployments"),
+					ghttp.RespondWithJSONEncoded(200, GardenRuncIndexDeployment()),
+				),
+			)
+
+			StartGenerator("-requiredReleases", "cf,diego,garden-linux")
+			Eventually(session).Should(gexec.Exit(4))
+		})
+
+		It("only accepts deployments with those releases", func() {
+			Expect(session.Err).Should(gbytes.Say("No deployment matched, deployments found: cf, cf-warden-diego."))
+		})
+	})
+
+	Context("when several deployments match", func() {
+		BeforeEach(func() {
+			server = ghttp.NewServer()
+			server.AppendHandlers(
+				BasicAuthInfoHandler(),
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("GET", "/deployments"),
+					ghttp.RespondWithJSONEncoded(200, AmbiguousIndexDeployment()),
+				),
+			)
+
+			StartGenerator()
+			Eventually(session).Should(gexec.Exit(4))
+		})
+
+		It("lists the candidate deployments", func() {
+			Expect(session.Err).Should(gbytes.Say("Candidate deployments: cf-warden-diego, cf-warden-diego-2."))
+		})
+	})
+
+	Context("with a deployment name pattern", func() {
+		BeforeEach(func() {
+			server = CreateServer("syslog_manifest.yml", AmbiguousIndexDeployment())
+			StartGenerator("-deploymentPattern", "^cf-warden-diego$")
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("picks the deployment matching the pattern", func() {
+			Expect(server.ReceivedRequests()).To(HaveLen(3))
+			Expect(server.ReceivedRequests()[2].URL.Path).To(Equal("/deployments/cf-warden-diego"))
+		})
+	})
+})
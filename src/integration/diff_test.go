@@ -0,0 +1,121 @@
+package integration_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+func fingerprint(cert *testCert) string {
+	sum := sha256.Sum256(cert.cert.Raw)
+	bytes := []string{}
+	for _, b := range sum {
+		bytes = append(bytes, fmt.Sprintf("%02X", b))
+	}
+	return strings.Join(bytes, ":")
+}
+
+var _ = Describe("Diff", func() {
+	var tmpDir string
+	var session *gexec.Session
+
+	UseTempDir(&tmpDir)
+
+	StartDiff := func(oldManifest, newManifest string, extraArgs ...string) {
+		session = StartGeneratorWithArgs(append([]string{
+			"diff",
+			"-oldManifest", oldManifest,
+			"-manifest", newManifest,
+		}, extraArgs...)...)
+	}
+
+	It("reports no changes between equal manifests", func() {
+		StartDiff("one_zone_manifest.yml", WriteManifest(tmpDir, "one_zone_manifest.yml"))
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("No changes"))
+	})
+
+	It("reports the changed installer arguments", func() {
+		StartDiff("one_zone_manifest.yml", WriteManifest(tmpDir, "one_zone_manifest.yml", "- 127.0.0.1", "- 10.0.0.1"))
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("Zone zone1:"))
+		Expect(session.Out).To(gbytes.Say("  CONSUL_IPS: 127.0.0.1 -> 10.0.0.1"))
+	})
+
+	It("redacts changed secrets", func() {
+		StartDiff("one_zone_manifest.yml", WriteManifest(tmpDir, "one_zone_manifest.yml", "secret123", "secret456", "BBS_CLIENT_KEY", "NEW_BBS_CLIENT_KEY"))
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("  LOGGREGATOR_SHARED_SECRET: changed"))
+		Expect(session.Out).To(gbytes.Say("  bbs_client.key: changed"))
+		Expect(session.Out).NotTo(gbytes.Say("secret"))
+		Expect(session.Out).NotTo(gbytes.Say("NEW_BBS_CLIENT_KEY"))
+	})
+
+	It("reports removed files", func() {
+		StartDiff("one_zone_manifest.yml", "no_bbs_cert_manifest.yml")
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say(`  bbs_ca.crt: removed`))
+	})
+
+	It("reports the fingerprints of changed certificates", func() {
+		now := time.Now()
+		ca := generateCert("ca", nil, now.Add(-time.Hour), now.Add(24*time.Hour))
+		consul := generateCert("consul", ca, now.Add(-time.Hour), now.Add(24*time.Hour))
+		oldBBS := generateCert("bbs", ca, now.Add(-time.Hour), now.Add(24*time.Hour))
+		newBBS := generateCert("bbs", ca, now.Add(-time.Hour), now.Add(48*time.Hour))
+
+		tmpl := template.Must(template.New("").Funcs(template.FuncMap{
+			"yaml": func(value string) string {
+				return "|\n          " + strings.Replace(strings.TrimSpace(value), "\n", "\n          ", -1)
+			},
+		}).Parse(certsManifestTemplate))
+		writeCertsManifest := func(name string, bbs *testCert) string {
+			manifestFile, err := os.Create(path.Join(tmpDir, name))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tmpl.Execute(manifestFile, certsManifest{
+				ConsulCA: ca.CertPEM, ConsulCert: consul.CertPEM, ConsulKey: consul.KeyPEM,
+				BBSCA: ca.CertPEM, BBSCert: bbs.CertPEM, BBSKey: bbs.KeyPEM,
+			})).To(Succeed())
+			Expect(manifestFile.Close()).To(Succeed())
+			return manifestFile.Name()
+		}
+
+		StartDiff(writeCertsManifest("old.yml", oldBBS), writeCertsManifest("new.yml", newBBS))
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("  bbs_client.crt: " + fingerprint(oldBBS) + " -> " + fingerprint(newBBS)))
+		Expect(session.Out).To(gbytes.Say("  bbs_client.key: changed"))
+		Expect(session.Out).NotTo(gbytes.Say("consul_ca.crt"))
+	})
+
+	It("compares every zone", func() {
+		StartDiff("multi_zone_manifest.yml", "multi_zone_manifest.yml")
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("No changes"))
+
+		StartDiff("one_zone_manifest.yml", "multi_zone_manifest.yml")
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("Zone z1:"))
+		Expect(session.Out).To(gbytes.Say("  CONSUL_IPS: added 127.0.0.1"))
+		Expect(session.Out).To(gbytes.Say("Zone zone1:"))
+		Expect(session.Out).To(gbytes.Say("  CONSUL_IPS: removed 127.0.0.1"))
+	})
+
+	It("requires the old manifest", func() {
+		session = StartGeneratorWithArgs("diff", "-manifest", "one_zone_manifest.yml")
+		Eventually(session).Should(gexec.Exit(1))
+	})
+
+	It("fails on a missing old manifest", func() {
+		StartDiff(path.Join(tmpDir, "missing.yml"), "one_zone_manifest.yml")
+		Eventually(session).Should(gexec.Exit(1))
+	})
+})
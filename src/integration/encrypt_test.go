@@ -0,0 +1,131 @@
+package integration_test
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("Encrypted output", func() {
+	var tmpDir, zipFile, decryptedFile, passphraseFile string
+
+	UseTempDir(&tmpDir)
+
+	BeforeEach(func() {
+		zipFile = path.Join(tmpDir, "cell.zip.enc")
+		decryptedFile = path.Join(tmpDir, "cell.zip")
+		passphraseFile = path.Join(tmpDir, "passphrase")
+		Expect(ioutil.WriteFile(passphraseFile, []byte("correct horse battery staple\n"), 0600)).To(Succeed())
+	})
+
+	Generate := func(extraArgs ...string) *gexec.Session {
+		return StartGeneratorAsAdmin(append([]string{
+			"-manifest", "one_zone_manifest.yml",
+			"-outputZip", zipFile,
+			"-skipCertValidation",
+			"-machineIp", "127.0.0.1",
+		}, extraArgs...)...)
+	}
+
+	Decrypt := func(args ...string) *gexec.Session {
+		return StartGeneratorWithArgs(append([]string{"decrypt", "-in", zipFile, "-out", decryptedFile}, args...)...)
+	}
+
+	ExpectDecryptedBundle := func() {
+		reader, err := zip.OpenReader(decryptedFile)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		names := []string{}
+		for _, file := range reader.File {
+			names = append(names, file.Name)
+		}
+		Expect(names).To(ContainElement("consul_agent.key"))
+		Expect(names).To(ContainElement("bbs_client.key"))
+
+		info, err := os.Stat(decryptedFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+	}
+
+	Context("with a passphrase", func() {
+		BeforeEach(func() {
+			Eventually(Generate("-encryptPassphraseFile", passphraseFile)).Should(gexec.Exit(0))
+		})
+
+		It("does not write the keys in plaintext", func() {
+			content, err := ioutil.ReadFile(zipFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(HavePrefix("diego-windows-bundle/v1\npassphrase "))
+			Expect(string(content)).NotTo(ContainSubstring("consul_agent.key"))
+
+			_, err = zip.OpenReader(zipFile)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("decrypts with the same passphrase", func() {
+			Eventually(Decrypt("-passphraseFile", passphraseFile)).Should(gexec.Exit(0))
+			ExpectDecryptedBundle()
+		})
+
+		It("fails with a wrong passphrase", func() {
+			Expect(ioutil.WriteFile(passphraseFile, []byte("wrong"), 0600)).To(Succeed())
+			session := Decrypt("-passphraseFile", passphraseFile)
+			Eventually(session).Should(gexec.Exit(8))
+			Expect(session.Err).To(gbytes.Say("wrong passphrase or key"))
+			Expect(decryptedFile).NotTo(BeAnExistingFile())
+		})
+	})
+
+	Context("with a recipient key", func() {
+		var identityFile string
+
+		BeforeEach(func() {
+			identityFile = path.Join(tmpDir, "identity")
+			keygen := StartGeneratorWithArgs("keygen", "-out", identityFile)
+			Eventually(keygen).Should(gexec.Exit(0))
+			publicKey := strings.TrimSpace(string(keygen.Out.Contents()))
+
+			info, err := os.Stat(identityFile)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			Eventually(Generate("-encryptRecipient", publicKey)).Should(gexec.Exit(0))
+		})
+
+		It("decrypts with the private key", func() {
+			Eventually(Decrypt("-identity", identityFile)).Should(gexec.Exit(0))
+			ExpectDecryptedBundle()
+		})
+
+		It("fails with another private key", func() {
+			otherIdentity := path.Join(tmpDir, "other")
+			Eventually(StartGeneratorWithArgs("keygen", "-out", otherIdentity)).Should(gexec.Exit(0))
+
+			Eventually(Decrypt("-identity", otherIdentity)).Should(gexec.Exit(8))
+		})
+
+		It("cannot be decrypted with a passphrase", func() {
+			session := Decrypt("-passphraseFile", passphraseFile)
+			Eventually(session).Should(gexec.Exit(8))
+			Expect(session.Err).To(gbytes.Say("not encrypted with a passphrase"))
+		})
+	})
+
+	It("requires -outputZip", func() {
+		session := StartGeneratorWithArgs(
+			"-manifest", "one_zone_manifest.yml",
+			"-outputDir", tmpDir,
+			"-encryptPassphraseFile", passphraseFile,
+		)
+		Eventually(session).Should(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("Usage of generate"))
+	})
+})
@@ -0,0 +1,80 @@
+package integration_test
+
+import (
+	"os"
+	"path"
+
+	"models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("Etcd cluster", func() {
+	var outputDir string
+	var manifest string
+	var session *gexec.Session
+
+	UseTempDir(&outputDir)
+
+	JustBeforeEach(func() {
+		session = StartGeneratorAsAdmin(
+			"-manifest", manifest,
+			"-outputDir", outputDir,
+			"-skipCertValidation",
+			"-machineIp", "127.0.0.1",
+		)
+		Eventually(session).Should(gexec.Exit(0))
+	})
+
+	Context("with several machines", func() {
+		BeforeEach(func() {
+			manifest = "etcd_multiple_machines_manifest.yml"
+		})
+
+		It("passes all machines to the installer", func() {
+			Expect(ReadOutputFile(outputDir, "install.bat")).To(Equal(ExpectedContent(models.InstallerArguments{
+				ConsulRequireSSL: true,
+				SyslogHostIP:     "logs2.test.com",
+				BbsRequireSsl:    true,
+				Username:         "admin",
+				Password:         `"""password"""`,
+				EtcdCluster:      "http://etcd1.foo.bar:4001,http://etcd2.foo.bar:4001",
+			})))
+		})
+
+		It("does not generate the etcd certificates", func() {
+			_, err := os.Stat(path.Join(outputDir, "etcd_ca.crt"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+
+	Context("when etcd requires TLS", func() {
+		BeforeEach(func() {
+			manifest = "etcd_tls_manifest.yml"
+		})
+
+		It("uses https and the configured port for every machine", func() {
+			args := models.InstallerArguments{
+				ConsulRequireSSL: true,
+				SyslogHostIP:     "logs2.test.com",
+				BbsRequireSsl:    true,
+				Username:         "admin",
+				Password:         `"""password"""`,
+				EtcdCluster:      "https://etcd1.foo.bar:4002,https://etcd2.foo.bar:4002,https://etcd3.foo.bar:4002",
+				EtcdRequireSSL:   true,
+			}
+			Expect(ReadOutputFile(outputDir, "install.bat")).To(Equal(ExpectedContent(args)))
+
+			args.Password = `'password'`
+			Expect(ReadOutputFile(outputDir, "install.ps1")).To(Equal(ExpectedPowershellContent(args)))
+		})
+
+		It("generates the etcd certificates", func() {
+			Expect(ReadOutputFile(outputDir, "etcd_ca.crt")).To(Equal("ETCD_CA_CERT"))
+			Expect(ReadOutputFile(outputDir, "etcd_client.crt")).To(Equal("ETCD_CLIENT_CERT"))
+			Expect(ReadOutputFile(outputDir, "etcd_client.key")).To(Equal("ETCD_CLIENT_KEY"))
+		})
+	})
+})
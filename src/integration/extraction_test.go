@@ -0,0 +1,66 @@
+package integration_test
+
+import (
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("Extracting files from the manifest", func() {
+	var outputDir string
+	var session *gexec.Session
+
+	UseTempDir(&outputDir)
+
+	// StartGenerator runs the generator on the one zone manifest with the
+	// given replacements.
+	StartGenerator := func(replacements ...string) {
+		session = StartGeneratorAsAdmin(
+			"-manifest", WriteManifest(outputDir, "one_zone_manifest.yml", replacements...),
+			"-outputDir", path.Join(outputDir, "scripts"),
+			"-skipCertValidation",
+			"-machineIp", "127.0.0.1",
+		)
+	}
+
+	It("writes every file when properties share a value", func() {
+		StartGenerator(
+			"CONSUL_CA_CERT", "SHARED_CERT",
+			"CONSUL_AGENT_CERT", "SHARED_CERT",
+			"BBS_CA_CERT", "SHARED_CERT",
+		)
+		Eventually(session).Should(gexec.Exit(0))
+
+		for _, name := range []string{"consul_ca.crt", "consul_agent.crt", "bbs_ca.crt"} {
+			Expect(ReadOutputFile(path.Join(outputDir, "scripts"), name)).To(Equal("SHARED_CERT"))
+		}
+		Expect(ReadOutputFile(path.Join(outputDir, "scripts"), "consul_agent.key")).To(Equal("CONSUL_AGENT_KEY"))
+		Expect(ReadOutputFile(path.Join(outputDir, "scripts"), "bbs_client.crt")).To(Equal("BBS_CLIENT_CERT"))
+		Expect(ReadOutputFile(path.Join(outputDir, "scripts"), "bbs_client.key")).To(Equal("BBS_CLIENT_KEY"))
+	})
+
+	It("fails on an empty required property", func() {
+		StartGenerator("client_key: BBS_CLIENT_KEY", `client_key: ""`)
+		Eventually(session).Should(gexec.Exit(5))
+		Expect(session.Err).To(gbytes.Say("Missing manifest property diego.rep.bbs.client_key"))
+		Expect(path.Join(outputDir, "scripts", "install.bat")).NotTo(BeAnExistingFile())
+	})
+
+	It("names the first of several empty properties", func() {
+		StartGenerator(
+			"agent_cert: CONSUL_AGENT_CERT", `agent_cert: ""`,
+			"agent_key: CONSUL_AGENT_KEY", `agent_key: ""`,
+		)
+		Eventually(session).Should(gexec.Exit(5))
+		Expect(session.Err).To(gbytes.Say("Missing manifest property consul.agent_cert"))
+	})
+
+	It("fails without a Consul encryption key", func() {
+		StartGenerator("- mBevws9TpU1sFPHK/Fq0IQ==", "")
+		Eventually(session).Should(gexec.Exit(5))
+		Expect(session.Err).To(gbytes.Say("Missing manifest property consul.encrypt_keys"))
+	})
+})
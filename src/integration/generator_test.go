@@ -0,0 +1,111 @@
+package integration_test
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"generator"
+	"models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeSyslog stands in for the Ops Manager API.
+type fakeSyslog struct {
+	syslog *models.SyslogProperties
+}
+
+func (f fakeSyslog) Syslog() (*models.SyslogProperties, error) {
+	return f.syslog, nil
+}
+
+var _ = Describe("Generator package", func() {
+	var options generator.Options
+
+	BeforeEach(func() {
+		options = generator.Options{
+			Username:  "admin",
+			Password:  "password",
+			MachineIp: "10.0.0.10",
+
+			SkipCertValidation: true,
+		}
+	})
+
+	It("generates the bundle in memory", func() {
+		bundle, err := generator.Generate(context.Background(), generator.FileSource{Path: "one_zone_manifest.yml"}, options)
+		Expect(err).NotTo(HaveOccurred())
+
+		sink := generator.MemorySink{}
+		Expect(bundle.Write(sink)).To(Succeed())
+		Expect(sink).To(HaveKey("install.bat"))
+		Expect(sink).To(HaveKey("install.ps1"))
+		Expect(string(sink["bbs_client.crt"])).To(Equal("BBS_CLIENT_CERT"))
+
+		Expect(bundle.Zones).To(HaveLen(1))
+		Expect(bundle.Zones[0].Dir).To(BeEmpty())
+		Expect(bundle.Zones[0].Arguments.Zone).To(Equal("zone1"))
+		Expect(bundle.Zones[0].Arguments.MachineIp).To(Equal("10.0.0.10"))
+	})
+
+	It("reads the manifest from a reader", func() {
+		file, err := os.Open("one_zone_manifest.yml")
+		Expect(err).NotTo(HaveOccurred())
+		defer file.Close()
+
+		bundle, err := generator.Generate(context.Background(), generator.ReaderSource{Reader: file}, options)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundle.Zones[0].Arguments.SharedSecret).To(Equal("secret123"))
+	})
+
+	It("places the files of several zones into subdirectories", func() {
+		bundle, err := generator.Generate(context.Background(), generator.FileSource{Path: "multi_zone_manifest.yml"}, options)
+		Expect(err).NotTo(HaveOccurred())
+
+		sink := generator.MemorySink{}
+		Expect(bundle.Write(sink)).To(Succeed())
+		for _, zone := range bundle.Zones {
+			Expect(sink).To(HaveKey(zone.Dir + "/install.bat"))
+		}
+	})
+
+	It("returns typed errors", func() {
+		_, err := generator.Generate(context.Background(), generator.FileSource{Path: "no_bbs_manifest.yml"}, options)
+		Expect(err).To(BeAssignableToTypeOf(&generator.MissingPropertyError{}))
+		Expect(generator.ExitCode(err)).To(Equal(generator.ExitCodeManifest))
+	})
+
+	It("fetches the manifest from the director", func() {
+		server := CreateServer("one_zone_manifest.yml", DefaultIndexDeployment())
+		defer server.Close()
+
+		filter, err := generator.NewDeploymentFilter(generator.DefaultRequiredReleases, "")
+		Expect(err).NotTo(HaveOccurred())
+		client, err := generator.NewBoshHTTPClient("", false)
+		Expect(err).NotTo(HaveOccurred())
+
+		source := &generator.DirectorSource{HTTPClient: client, URL: server.URL(), Filter: filter}
+		bundle, err := generator.Generate(context.Background(), source, options)
+		Expect(err).NotTo(HaveOccurred())
+
+		sink := generator.MemorySink{}
+		Expect(bundle.Write(sink)).To(Succeed())
+		Expect(strings.TrimSpace(string(sink["install.bat"]))).To(Equal(ExpectedContent(models.InstallerArguments{
+			ConsulRequireSSL: true,
+			BbsRequireSsl:    true,
+			MachineIp:        "10.0.0.10",
+			Username:         "admin",
+			Password:         `"""password"""`,
+		})))
+	})
+
+	It("takes the syslog settings from the Syslog source", func() {
+		options.Syslog = fakeSyslog{&models.SyslogProperties{Address: "logs.example.com", Port: "514"}}
+		bundle, err := generator.Generate(context.Background(), generator.FileSource{Path: "ops_manager_no_syslog_manifest.yml"}, options)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundle.Zones[0].Arguments.SyslogHostIP).To(Equal("logs.example.com"))
+		Expect(bundle.Zones[0].Arguments.SyslogPort).To(Equal("514"))
+	})
+})
@@ -3,6 +3,7 @@ package integration_test
 import (
 	"bytes"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"os/exec"
 	"path"
@@ -32,6 +33,7 @@ func CreateServer(manifest string, deployments []models.IndexDeployment) *ghttp.
 
 	server := ghttp.NewServer()
 	server.AppendHandlers(
+		BasicAuthInfoHandler(),
 		ghttp.CombineHandlers(
 			ghttp.VerifyRequest("GET", "/deployments"),
 			ghttp.RespondWithJSONEncoded(200, deployments),
@@ -45,9 +47,20 @@ func CreateServer(manifest string, deployments []models.IndexDeployment) *ghttp.
 	return server
 }
 
+func BasicAuthInfoHandler() http.HandlerFunc {
+	info := models.DirectorInfo{}
+	info.UserAuthentication.Type = "basic"
+
+	return ghttp.CombineHandlers(
+		ghttp.VerifyRequest("GET", "/info"),
+		ghttp.RespondWithJSONEncoded(200, info),
+	)
+}
+
 func Create401Server() *ghttp.Server {
 	server := ghttp.NewServer()
 	server.AppendHandlers(
+		BasicAuthInfoHandler(),
 		ghttp.CombineHandlers(
 			ghttp.VerifyRequest("GET", "/deployments"),
 			ghttp.RespondWith(401, "Not authorized"),
@@ -57,17 +70,63 @@ func Create401Server() *ghttp.Server {
 	return server
 }
 
-func StartGeneratorWithURL(serverUrl string) (*gexec.Session, string) {
+func StartGeneratorWithURL(serverUrl string, extraArgs ...string) (*gexec.Session, string) {
 	var err error
 	outputDir, err := ioutil.TempDir("", "XXXXXXX")
 	Expect(err).NotTo(HaveOccurred())
 
-	return StartGeneratorWithArgs(
+	return StartGeneratorAsAdmin(append([]string{
 		"-boshUrl", serverUrl,
 		"-outputDir", outputDir,
+	}, extraArgs...)...), outputDir
+}
+
+// StartGeneratorAsAdmin runs the generator with the Windows credentials the
+// expected scripts contain.
+func StartGeneratorAsAdmin(args ...string) *gexec.Session {
+	return StartGeneratorWithArgs(append([]string{
 		"-windowsUsername", "admin",
 		"-windowsPassword", "password",
-	), outputDir
+	}, args...)...)
+}
+
+// UseTempDir creates a temporary directory in dir before each test of the
+// enclosing container and removes it after the test.
+func UseTempDir(dir *string) {
+	BeforeEach(func() {
+		var err error
+		*dir, err = ioutil.TempDir("", "XXXXXXX")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(*dir)).To(Succeed())
+	})
+}
+
+// ReadOutputFile returns the content of the generated file name in dir
+// without the surrounding whitespace.
+func ReadOutputFile(dir, name string) string {
+	content, err := ioutil.ReadFile(path.Join(dir, name))
+	Expect(err).NotTo(HaveOccurred())
+	return strings.TrimSpace(string(content))
+}
+
+// WriteManifest copies the manifest fixture into dir with the old, new pairs
+// of replacements applied and returns the path of the copy.
+func WriteManifest(dir, fixture string, replacements ...string) string {
+	content, err := ioutil.ReadFile(fixture)
+	Expect(err).NotTo(HaveOccurred())
+	manifest := path.Join(dir, fixture)
+	Expect(ioutil.WriteFile(manifest, []byte(strings.NewReplacer(replacements...).Replace(string(content))), 0600)).To(Succeed())
+	return manifest
+}
+
+// FileMode returns the permission bits of the generated file name in dir.
+func FileMode(dir, name string) os.FileMode {
+	info, err := os.Stat(path.Join(dir, name))
+	Expect(err).NotTo(HaveOccurred())
+	return info.Mode().Perm()
 }
 
 func StartGeneratorWithArgs(args ...string) *gexec.Session {
@@ -177,9 +236,9 @@ func ExpectedContent(args models.InstallerArguments) string {
   BBS_CLIENT_CERT_FILE=%~dp0\bbs_client.crt ^
   BBS_CLIENT_KEY_FILE=%~dp0\bbs_client.key ^{{ end }}
   CONSUL_IPS=127.0.0.1 ^
-  CF_ETCD_CLUSTER=http://etcd1.foo.bar:4001 ^
-  STACK=windows2012R2 ^
-  REDUNDANCY_ZONE=windows ^
+  CF_ETCD_CLUSTER={{if .EtcdCluster }}{{.EtcdCluster}}{{else}}http://etcd1.foo.bar:4001{{end}} ^
+  STACK={{if .Stack }}{{.Stack}}{{else}}windows2012R2{{end}} ^
+  REDUNDANCY_ZONE={{if .Zone }}{{.Zone}}{{else}}zone1{{end}} ^
   LOGGREGATOR_SHARED_SECRET=secret123 ^
   MACHINE_IP={{if .MachineIp }}{{.MachineIp}}{{else}}127.0.0.1{{end}}{{ if .SyslogHostIP }} ^
   SYSLOG_HOST_IP=logs2.test.com ^
@@ -187,14 +246,17 @@ func ExpectedContent(args models.InstallerArguments) string {
   CONSUL_ENCRYPT_FILE=%~dp0\consul_encrypt.key ^
   CONSUL_CA_FILE=%~dp0\consul_ca.crt ^
   CONSUL_AGENT_CERT_FILE=%~dp0\consul_agent.crt ^
-  CONSUL_AGENT_KEY_FILE=%~dp0\consul_agent.key{{end}}
+  CONSUL_AGENT_KEY_FILE=%~dp0\consul_agent.key{{end}}{{if .EtcdRequireSSL }} ^
+  ETCD_CA_FILE=%~dp0\etcd_ca.crt ^
+  ETCD_CERT_FILE=%~dp0\etcd_client.crt ^
+  ETCD_KEY_FILE=%~dp0\etcd_client.key{{end}}{{ if ne .Stack "windows2016" }}
 
 msiexec /passive /norestart /i %~dp0\GardenWindows.msi ^
   ADMIN_USERNAME={{.Username}} ^
   ADMIN_PASSWORD={{.Password}} ^
   MACHINE_IP={{if .MachineIp }}{{.MachineIp}}{{else}}127.0.0.1{{end}}{{ if .SyslogHostIP }} ^
   SYSLOG_HOST_IP=logs2.test.com ^
-  SYSLOG_PORT=11111{{ end }}`
+  SYSLOG_PORT=11111{{ end }}{{ end }}`
 	content = strings.Replace(content, "\n", "\r\n", -1)
 	temp := template.Must(template.New("").Parse(content))
 	buf := bytes.NewBufferString("")
@@ -230,7 +292,7 @@ var _ = Describe("Generate", func() {
 	Describe("Success scenarios", func() {
 		Context("with default arguments", func() {
 			JustBeforeEach(func() {
-				session, outputDir = StartGeneratorWithURL(server.URL())
+				session, outputDir = StartGeneratorWithURL(server.URL(), "-skipCertValidation", "-machineIp", "127.0.0.1")
 				Eventually(session).Should(gexec.Exit(0))
 				content, err := ioutil.ReadFile(path.Join(outputDir, "install.bat"))
 				Expect(err).NotTo(HaveOccurred())
@@ -305,12 +367,12 @@ var _ = Describe("Generate", func() {
 					manifestYaml = "one_zone_manifest.yml"
 					server = CreateServer(manifestYaml, DefaultIndexDeployment())
 					var session *gexec.Session
-					session, outputDir = StartGeneratorWithURL(server.URL())
+					session, outputDir = StartGeneratorWithURL(server.URL(), "-skipCertValidation", "-machineIp", "127.0.0.1")
 					Eventually(session).Should(gexec.Exit(-1))
 				})
 
-				It("sends get requests to get the deployments", func() {
-					Expect(server.ReceivedRequests()).To(HaveLen(2))
+				It("sends get requests to get the director info and the deployments", func() {
+					Expect(server.ReceivedRequests()).To(HaveLen(3))
 				})
 
 				Context("consul files", func() {
@@ -439,6 +501,35 @@ var _ = Describe("Generate", func() {
 				})
 			})
 
+			Context("when the deployment uses a BOSH v2 manifest", func() {
+				BeforeEach(func() {
+					manifestYaml = "v2_manifest.yml"
+				})
+
+				It("gets the properties from the jobs colocated with rep", func() {
+					expectedContent := ExpectedContent(models.InstallerArguments{
+						ConsulRequireSSL: true,
+						SyslogHostIP:     "logs2.test.com",
+						BbsRequireSsl:    true,
+						Username:         "admin",
+						Password:         `"""password"""`,
+					})
+					Expect(script).To(Equal(expectedContent))
+				})
+
+				It("generates the consul certificate authority cert from the rep instance group", func() {
+					cert, err := ioutil.ReadFile(path.Join(outputDir, "consul_ca.crt"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(cert).To(BeEquivalentTo("CONSUL_CA_CERT"))
+				})
+
+				It("generates the bbs client cert", func() {
+					cert, err := ioutil.ReadFile(path.Join(outputDir, "bbs_client.crt"))
+					Expect(err).NotTo(HaveOccurred())
+					Expect(cert).To(BeEquivalentTo("BBS_CLIENT_CERT"))
+				})
+			})
+
 			Context("when the deployment does not has metron tls enabled", func() {
 				BeforeEach(func() {
 					manifestYaml = "one_zone_manifest.yml"
@@ -493,6 +584,7 @@ var _ = Describe("Generate", func() {
 					"-outputDir", outputDir,
 					"-windowsUsername", "admin",
 					"-windowsPassword", "password",
+					"-skipCertValidation",
 					"-machineIp", "10.10.3.21",
 				)
 				Eventually(session).Should(gexec.Exit(0))
@@ -513,6 +605,43 @@ var _ = Describe("Generate", func() {
 				Expect(script).To(Equal(expectedContent))
 			})
 		})
+		Context("with a local manifest file", func() {
+			UseTempDir(&outputDir)
+
+			JustBeforeEach(func() {
+				session = StartGeneratorAsAdmin(
+					"-manifest", manifestYaml,
+					"-outputDir", outputDir,
+					"-skipCertValidation",
+					"-machineIp", "127.0.0.1",
+				)
+				Eventually(session).Should(gexec.Exit(0))
+				content, err := ioutil.ReadFile(path.Join(outputDir, "install.bat"))
+				Expect(err).NotTo(HaveOccurred())
+				script = strings.TrimSpace(string(content))
+			})
+
+			It("does not contact the BOSH director", func() {
+				Expect(server.ReceivedRequests()).To(BeEmpty())
+			})
+
+			It("contains all the MSI parameters", func() {
+				expectedContent := ExpectedContent(models.InstallerArguments{
+					ConsulRequireSSL: true,
+					SyslogHostIP:     "logs2.test.com",
+					BbsRequireSsl:    true,
+					Username:         "admin",
+					Password:         `"""password"""`,
+				})
+				Expect(script).To(Equal(expectedContent))
+			})
+
+			It("generates the consul files", func() {
+				cert, err := ioutil.ReadFile(path.Join(outputDir, "consul_ca.crt"))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(cert).To(BeEquivalentTo("CONSUL_CA_CERT"))
+			})
+		})
 	})
 
 	Describe("Failure scenarios", func() {
@@ -533,6 +662,8 @@ var _ = Describe("Generate", func() {
 					"-outputDir", outputDir,
 					"-windowsUsername", username,
 					"-windowsPassword", password,
+					"-skipCertValidation",
+					"-machineIp", "127.0.0.1",
 				)
 			})
 
@@ -591,7 +722,7 @@ var _ = Describe("Generate", func() {
 
 			BeforeEach(func() {
 				session, outputDir = StartGeneratorWithURL("http://1.2.3.4:5555")
-				Eventually(session, "15s", "1s").Should(gexec.Exit(1))
+				Eventually(session, "15s", "1s").Should(gexec.Exit(2))
 			})
 
 			It("displays the reponse error to the user", func() {
@@ -605,7 +736,7 @@ var _ = Describe("Generate", func() {
 			BeforeEach(func() {
 				server := Create401Server()
 				session, outputDir = StartGeneratorWithURL(server.URL())
-				Eventually(session).Should(gexec.Exit(1))
+				Eventually(session).Should(gexec.Exit(3))
 			})
 
 			It("displays the reponse error to the user", func() {
@@ -620,7 +751,7 @@ var _ = Describe("Generate", func() {
 			BeforeEach(func() {
 				server = CreateServer("one_zone_manifest.yml", AmbiguousIndexDeployment())
 				session, outputDir = StartGeneratorWithURL(server.URL())
-				Eventually(session).Should(gexec.Exit(1))
+				Eventually(session).Should(gexec.Exit(4))
 			})
 
 			It("displays the reponse error to the user", func() {
@@ -640,6 +771,24 @@ var _ = Describe("Generate", func() {
 			})
 		})
 
+		Context("when the manifest file does not exist", func() {
+			var session *gexec.Session
+
+			UseTempDir(&outputDir)
+
+			BeforeEach(func() {
+				session = StartGeneratorAsAdmin(
+					"-manifest", "does_not_exist.yml",
+					"-outputDir", outputDir,
+				)
+				Eventually(session).Should(gexec.Exit(1))
+			})
+
+			It("displays an error to the user", func() {
+				Expect(session.Err).Should(gbytes.Say("Could not read manifest file"))
+			})
+		})
+
 		Context("when no consul servers are found in the manifest", func() {
 			var server *ghttp.Server
 			var session *gexec.Session
@@ -647,13 +796,55 @@ var _ = Describe("Generate", func() {
 			BeforeEach(func() {
 				server = CreateServer("no_consul_manifest.yml", DefaultIndexDeployment())
 				session, outputDir = StartGeneratorWithURL(server.URL())
-				Eventually(session).Should(gexec.Exit(1))
+				Eventually(session).Should(gexec.Exit(5))
 			})
 
 			It("displays an error to the user", func() {
 				Expect(session.Err).Should(gbytes.Say("Could not find any Consul VMs in your BOSH deployment"))
 			})
 		})
+
+		Context("when the manifest lacks the BBS properties", func() {
+			var session *gexec.Session
+
+			UseTempDir(&outputDir)
+
+			BeforeEach(func() {
+				session = StartGeneratorAsAdmin(
+					"-manifest", "no_bbs_manifest.yml",
+					"-outputDir", outputDir,
+					"-skipCertValidation",
+					"-machineIp", "127.0.0.1",
+				)
+				Eventually(session).Should(gexec.Exit(5))
+			})
+
+			It("names the missing property", func() {
+				Expect(session.Err).Should(gbytes.Say("Missing manifest property diego.rep.bbs"))
+			})
+		})
+
+		Context("when the output directory cannot be written", func() {
+			var session *gexec.Session
+
+			UseTempDir(&outputDir)
+
+			BeforeEach(func() {
+				file := path.Join(outputDir, "file")
+				Expect(ioutil.WriteFile(file, nil, 0600)).To(Succeed())
+				session = StartGeneratorAsAdmin(
+					"-manifest", "one_zone_manifest.yml",
+					"-outputDir", path.Join(file, "output"),
+					"-skipCertValidation",
+					"-machineIp", "127.0.0.1",
+				)
+				Eventually(session).Should(gexec.Exit(6))
+			})
+
+			It("displays an error to the user", func() {
+				Expect(session.Err).Should(gbytes.Say("Could not write"))
+			})
+		})
 	})
 
 	Context("when ran with an ouputDir param that points to a dir that doesn't exist", func() {
@@ -668,6 +859,8 @@ var _ = Describe("Generate", func() {
 				"-boshUrl", server.URL(),
 				"-outputDir", nonExistingDir,
 				"-windowsUsername", "admin",
+				"-skipCertValidation",
+				"-machineIp", "127.0.0.1",
 				"-windowsPassword", "password",
 			)
 		})
@@ -0,0 +1,131 @@
+package integration_test
+
+import (
+	"io/ioutil"
+	"path"
+	"regexp"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	"github.com/onsi/gomega/ghttp"
+)
+
+var _ = Describe("Inventory", func() {
+	var tmpDir, outputDir, inventory string
+
+	UseTempDir(&tmpDir)
+
+	BeforeEach(func() {
+		outputDir = path.Join(tmpDir, "cells")
+		inventory = path.Join(tmpDir, "cells.csv")
+	})
+
+	WriteInventory := func(name, content string) {
+		inventory = path.Join(tmpDir, name)
+		Expect(ioutil.WriteFile(inventory, []byte(content), 0600)).To(Succeed())
+	}
+
+	Context("when all cells can be generated", func() {
+		var server *ghttp.Server
+		var session *gexec.Session
+
+		BeforeEach(func() {
+			WriteInventory("cells.csv", "hostname,machine_ip,zone,username,password\n"+
+				"cell-1,10.0.0.11,,,\n"+
+				"cell-2,10.0.0.12,zone2,other,secret\n")
+
+			server = DefaultServer()
+			session = StartGeneratorAsAdmin(
+				"-boshUrl", server.URL(),
+				"-outputDir", outputDir,
+				"-skipCertValidation",
+				"-inventory", inventory,
+			)
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("fetches the manifest once", func() {
+			Expect(server.ReceivedRequests()).To(HaveLen(3))
+		})
+
+		It("generates every cell into its own directory", func() {
+			first := ReadOutputFile(path.Join(outputDir, "cell-1"), "install.bat")
+			Expect(first).To(ContainSubstring("MACHINE_IP=10.0.0.11"))
+			Expect(first).To(ContainSubstring("REDUNDANCY_ZONE=zone1"))
+			Expect(first).To(ContainSubstring("ADMIN_USERNAME=admin"))
+
+			second := ReadOutputFile(path.Join(outputDir, "cell-2"), "install.bat")
+			Expect(second).To(ContainSubstring("MACHINE_IP=10.0.0.12"))
+			Expect(second).To(ContainSubstring("REDUNDANCY_ZONE=zone2"))
+			Expect(second).To(ContainSubstring("ADMIN_USERNAME=other"))
+			Expect(path.Join(outputDir, "cell-2", "consul_agent.key")).To(BeAnExistingFile())
+		})
+
+		It("reports the generated cells", func() {
+			Expect(session.Out).To(gbytes.Say("Generated scripts for cell cell-1 in " + path.Join(outputDir, "cell-1")))
+			Expect(session.Out).To(gbytes.Say("Generated scripts for cell cell-2 in " + path.Join(outputDir, "cell-2")))
+			Expect(session.Out).To(gbytes.Say("2 of 2 cells generated"))
+		})
+	})
+
+	It("reads YAML inventories", func() {
+		WriteInventory("cells.yml", "- hostname: cell-1\n  machine_ip: 10.0.0.11\n  zone: zone3\n")
+		session := StartGeneratorAsAdmin(
+			"-manifest", "one_zone_manifest.yml",
+			"-outputDir", outputDir,
+			"-skipCertValidation",
+			"-inventory", inventory,
+		)
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(ReadOutputFile(path.Join(outputDir, "cell-1"), "install.bat")).To(ContainSubstring("REDUNDANCY_ZONE=zone3"))
+	})
+
+	It("generates the remaining cells when one fails", func() {
+		WriteInventory("cells.csv", "hostname,machine_ip,username\n"+
+			"cell-1,10.0.0.11,not valid\n"+
+			"cell-2,10.0.0.12,\n")
+		session := StartGeneratorAsAdmin(
+			"-manifest", "one_zone_manifest.yml",
+			"-outputDir", outputDir,
+			"-skipCertValidation",
+			"-inventory", inventory,
+		)
+		Eventually(session).Should(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("FAILED cell-1: Invalid windowsUsername"))
+		Expect(session.Out).To(gbytes.Say("1 of 2 cells generated"))
+		Expect(path.Join(outputDir, "cell-1")).NotTo(BeAnExistingFile())
+		Expect(ReadOutputFile(path.Join(outputDir, "cell-2"), "install.bat")).To(ContainSubstring("MACHINE_IP=10.0.0.12"))
+	})
+
+	Context("with an invalid inventory", func() {
+		for _, invalid := range []struct {
+			description, content, message string
+		}{
+			{"without cells", "hostname,machine_ip\n", "no cells listed"},
+			{"without machine_ip column", "hostname\ncell-1\n", "missing column machine_ip"},
+			{"with an unknown column", "hostname,machine_ip,ip\n", `unknown column "ip"`},
+			{"with an invalid IP", "hostname,machine_ip\ncell-1,10.0.0\n", `invalid machine_ip "10.0.0"`},
+			{"with a path as hostname", "hostname,machine_ip\n../cell,10.0.0.1\n", `invalid hostname "../cell"`},
+			{"with duplicate hostnames", "hostname,machine_ip\ncell-1,10.0.0.1\nCELL-1,10.0.0.2\n", "duplicate hostname CELL-1"},
+		} {
+			invalid := invalid
+			It("fails "+invalid.description, func() {
+				WriteInventory("cells.csv", invalid.content)
+				session := StartGeneratorAsAdmin(
+					"-manifest", "one_zone_manifest.yml",
+					"-outputDir", outputDir,
+					"-skipCertValidation",
+					"-inventory", inventory,
+				)
+				Eventually(session).Should(gexec.Exit(1))
+				Expect(session.Err).To(gbytes.Say(regexp.QuoteMeta(invalid.message)))
+			})
+		}
+	})
+})
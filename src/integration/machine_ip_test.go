@@ -0,0 +1,136 @@
+package integration_test
+
+import (
+	"net"
+	"runtime"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+// usableInterface returns an interface of this machine with exactly one
+// IPv4 address that is neither loopback nor link-local.
+func usableInterface() (string, net.IP) {
+	interfaces, err := net.Interfaces()
+	Expect(err).NotTo(HaveOccurred())
+
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		Expect(err).NotTo(HaveOccurred())
+
+		ips := []net.IP{}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if ok && ipNet.IP.To4() != nil && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+				ips = append(ips, ipNet.IP)
+			}
+		}
+		if len(ips) == 1 {
+			return iface.Name, ips[0]
+		}
+	}
+	return "", nil
+}
+
+var _ = Describe("Machine IP", func() {
+	var outputDir string
+	var session *gexec.Session
+
+	UseTempDir(&outputDir)
+
+	// StartGenerator leaves the machine IP to the detection unless extraArgs
+	// set it.
+	StartGenerator := func(manifest string, extraArgs ...string) {
+		session = StartGeneratorAsAdmin(append([]string{
+			"-skipCertValidation",
+			"-manifest", manifest,
+			"-outputDir", outputDir,
+		}, extraArgs...)...)
+	}
+
+	It("rejects the loopback address on the route to Consul", func() {
+		StartGenerator("one_zone_manifest.yml")
+		Eventually(session).Should(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("uses the loopback address 127.0.0.1. Use -machineIp"))
+	})
+
+	It("accepts Consul servers given as hostname and port", func() {
+		StartGenerator(WriteManifest(outputDir, "one_zone_manifest.yml", "- 127.0.0.1", "- localhost:8301"))
+		Eventually(session).Should(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("the route to Consul at localhost uses the loopback address"))
+	})
+
+	It("rejects an invalid -machineIp", func() {
+		StartGenerator("one_zone_manifest.yml", "-machineIp", "10.0.0")
+		Eventually(session).Should(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("Invalid machineIp 10.0.0"))
+	})
+
+	It("rejects -machineIp together with -machineInterface", func() {
+		StartGenerator("one_zone_manifest.yml", "-machineIp", "10.0.0.1", "-machineInterface", "eth0")
+		Eventually(session).Should(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("Usage of generate"))
+	})
+
+	It("rejects an unknown interface", func() {
+		StartGenerator("one_zone_manifest.yml", "-machineInterface", "no-such-interface")
+		Eventually(session).Should(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("Invalid machineInterface no-such-interface"))
+	})
+
+	It("rejects an invalid subnet", func() {
+		StartGenerator("one_zone_manifest.yml", "-machineSubnet", "10.0.0.0")
+		Eventually(session).Should(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("Invalid machineSubnet 10.0.0.0, must be in CIDR notation"))
+	})
+
+	It("skips loopback addresses of the selected subnet", func() {
+		StartGenerator("one_zone_manifest.yml", "-machineSubnet", "127.0.0.0/8")
+		Eventually(session).Should(gexec.Exit(1))
+		Expect(session.Err).To(gbytes.Say("this machine has no non-loopback address in 127.0.0.0/8"))
+	})
+
+	Context("with a network interface", func() {
+		var name string
+		var ip net.IP
+
+		BeforeEach(func() {
+			name, ip = usableInterface()
+			if name == "" {
+				Skip("no interface with a single IPv4 address")
+			}
+		})
+
+		It("uses the address of -machineInterface", func() {
+			StartGenerator("one_zone_manifest.yml", "-machineInterface", name)
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(ReadOutputFile(outputDir, "install.bat")).To(ContainSubstring("MACHINE_IP=" + ip.String()))
+		})
+
+		It("uses the address in -machineSubnet", func() {
+			StartGenerator("one_zone_manifest.yml", "-machineSubnet", ip.String()+"/32")
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(ReadOutputFile(outputDir, "install.bat")).To(ContainSubstring("MACHINE_IP=" + ip.String()))
+		})
+
+		It("uses the local address on the route to Consul", func() {
+			StartGenerator(WriteManifest(outputDir, "one_zone_manifest.yml", "- 127.0.0.1", "- "+ip.String()+":8301"))
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(ReadOutputFile(outputDir, "install.bat")).To(ContainSubstring("MACHINE_IP=" + ip.String()))
+		})
+
+		It("warns that the detected address belongs to this machine", func() {
+			if runtime.GOOS == "windows" {
+				Skip("the warning is only given on other systems")
+			}
+			StartGenerator("one_zone_manifest.yml", "-machineInterface", name)
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(session.Err).To(gbytes.Say("WARNING: Detected machine IP " + ip.String() + " on .*, which does not run Windows"))
+		})
+	})
+})
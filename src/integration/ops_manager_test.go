@@ -0,0 +1,177 @@
+package integration_test
+
+import (
+	"net/url"
+
+	"models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	"github.com/onsi/gomega/ghttp"
+)
+
+// OpsManagerProperties is the response of the staged product properties
+// endpoint with the Elastic Runtime's syslog settings.
+func OpsManagerProperties(host, port interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"properties": map[string]interface{}{
+			".properties.syslog_host": map[string]interface{}{"type": "string", "value": host},
+			".properties.syslog_port": map[string]interface{}{"type": "port", "value": port},
+		},
+	}
+}
+
+var _ = Describe("Ops Manager", func() {
+	var outputDir string
+	var opsManager *ghttp.Server
+	var session *gexec.Session
+
+	UseTempDir(&outputDir)
+
+	BeforeEach(func() {
+		opsManager = ghttp.NewServer()
+	})
+
+	AfterEach(func() {
+		opsManager.Close()
+	})
+
+	StartGenerator := func(manifest string, extraArgs ...string) {
+		session = StartGeneratorAsAdmin(append([]string{
+			"-manifest", manifest,
+			"-outputDir", outputDir,
+			"-skipCertValidation",
+			"-machineIp", "127.0.0.1",
+		}, extraArgs...)...)
+	}
+
+	StartGeneratorWithOpsManager := func(manifest string) {
+		StartGenerator(manifest,
+			"-opsManagerUrl", opsManager.URL(),
+			"-opsManagerUsername", "admin",
+			"-opsManagerPassword", "opsman-password",
+		)
+	}
+
+	AppendOpsManagerHandlers := func(properties map[string]interface{}) {
+		opsManager.AppendHandlers(
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/uaa/oauth/token"),
+				ghttp.VerifyBasicAuth("opsman", ""),
+				ghttp.VerifyForm(url.Values{
+					"grant_type": {"password"},
+					"username":   {"admin"},
+					"password":   {"opsman-password"},
+				}),
+				ghttp.RespondWithJSONEncoded(200, models.UAAToken{AccessToken: "opsman-token", ExpiresIn: 3600}),
+			),
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/api/v0/staged/products"),
+				ghttp.VerifyHeaderKV("Authorization", "Bearer opsman-token"),
+				ghttp.RespondWithJSONEncoded(200, []models.OpsManagerProduct{
+					{InstallationName: "p-bosh-0a1b2c", GUID: "p-bosh-0a1b2c", Type: "p-bosh"},
+					{InstallationName: "cf-4f6b7e", GUID: "cf-4f6b7e", Type: "cf"},
+				}),
+			),
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("GET", "/api/v0/staged/products/cf-4f6b7e/properties"),
+				ghttp.VerifyHeaderKV("Authorization", "Bearer opsman-token"),
+				ghttp.RespondWithJSONEncoded(200, properties),
+			),
+		)
+	}
+
+	Context("with a manifest without global properties", func() {
+		BeforeEach(func() {
+			StartGenerator("ops_manager_manifest.yml")
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("reads the properties of the diego_cell instance group", func() {
+			script := ReadOutputFile(outputDir, "install.bat")
+			Expect(script).To(ContainSubstring("CONSUL_IPS=127.0.0.1"))
+			Expect(script).To(ContainSubstring("REDUNDANCY_ZONE=zone1"))
+			Expect(script).To(ContainSubstring("LOGGREGATOR_SHARED_SECRET=secret123"))
+			Expect(script).To(ContainSubstring("BBS_CA_FILE="))
+		})
+
+		It("falls back to the diego_brain instance group", func() {
+			Expect(ReadOutputFile(outputDir, "install.bat")).To(ContainSubstring("CF_ETCD_CLUSTER=http://etcd.opsman.test:4001"))
+		})
+
+		It("takes syslog_daemon_config from other jobs", func() {
+			script := ReadOutputFile(outputDir, "install.bat")
+			Expect(script).To(ContainSubstring("SYSLOG_HOST_IP=logs.opsman.test"))
+			Expect(script).To(ContainSubstring("SYSLOG_PORT=514"))
+		})
+	})
+
+	It("prefers the syslog forwarder colocated with rep", func() {
+		StartGenerator(WriteManifest(outputDir, "ops_manager_manifest.yml", "shared_secret: secret123\n", "shared_secret: secret123\n"+`      - name: syslog_forwarder
+        release: syslog
+        properties:
+          syslog:
+            address: cell-logs.opsman.test
+            port: 1514
+`))
+		Eventually(session).Should(gexec.Exit(0))
+
+		script := ReadOutputFile(outputDir, "install.bat")
+		Expect(script).To(ContainSubstring("SYSLOG_HOST_IP=cell-logs.opsman.test"))
+		Expect(script).To(ContainSubstring("SYSLOG_PORT=1514"))
+	})
+
+	It("leaves BOSH v2 manifests without global properties alone", func() {
+		StartGenerator(WriteManifest(outputDir, "v2_manifest.yml", "port: 11111\n", "port: 11111\n"+`  - name: log-api
+    jobs:
+      - name: loggregator_trafficcontroller
+        release: loggregator
+        properties:
+          syslog_daemon_config:
+            address: other-logs.example.com
+            port: 514
+`))
+		Eventually(session).Should(gexec.Exit(0))
+
+		script := ReadOutputFile(outputDir, "install.bat")
+		Expect(script).To(ContainSubstring("SYSLOG_HOST_IP=logs2.test.com"))
+		Expect(script).To(ContainSubstring("SYSLOG_PORT=11111"))
+		Expect(script).NotTo(ContainSubstring("other-logs.example.com"))
+	})
+
+	It("does not ask Ops Manager when the manifest configures syslog", func() {
+		StartGeneratorWithOpsManager("ops_manager_manifest.yml")
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(opsManager.ReceivedRequests()).To(BeEmpty())
+		Expect(ReadOutputFile(outputDir, "install.bat")).To(ContainSubstring("SYSLOG_HOST_IP=logs.opsman.test"))
+	})
+
+	It("reads the syslog settings from the Ops Manager API", func() {
+		AppendOpsManagerHandlers(OpsManagerProperties("api.opsman.test", 6514))
+		StartGeneratorWithOpsManager("ops_manager_no_syslog_manifest.yml")
+		Eventually(session).Should(gexec.Exit(0))
+
+		script := ReadOutputFile(outputDir, "install.bat")
+		Expect(script).To(ContainSubstring("SYSLOG_HOST_IP=api.opsman.test"))
+		Expect(script).To(ContainSubstring("SYSLOG_PORT=6514"))
+	})
+
+	It("omits syslog when Ops Manager has none configured", func() {
+		AppendOpsManagerHandlers(OpsManagerProperties(nil, nil))
+		StartGeneratorWithOpsManager("ops_manager_no_syslog_manifest.yml")
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(ReadOutputFile(outputDir, "install.bat")).NotTo(ContainSubstring("SYSLOG_HOST_IP"))
+	})
+
+	It("fails when Ops Manager rejects the credentials", func() {
+		opsManager.AppendHandlers(ghttp.CombineHandlers(
+			ghttp.VerifyRequest("POST", "/uaa/oauth/token"),
+			ghttp.RespondWith(401, "Bad credentials"),
+		))
+		StartGeneratorWithOpsManager("ops_manager_no_syslog_manifest.yml")
+		Eventually(session).Should(gexec.Exit(3))
+		Expect(session.Err).To(gbytes.Say("Unable to authenticate with UAA"))
+	})
+})
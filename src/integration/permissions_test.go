@@ -0,0 +1,101 @@
+package integration_test
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("Output permissions", func() {
+	var tmpDir, outputDir string
+	var session *gexec.Session
+
+	UseTempDir(&tmpDir)
+
+	BeforeEach(func() {
+		outputDir = path.Join(tmpDir, "output")
+	})
+
+	StartGenerator := func(extraArgs ...string) {
+		args := append([]string{
+			"-manifest", "one_zone_manifest.yml",
+			"-skipCertValidation",
+			"-machineIp", "127.0.0.1",
+		}, extraArgs...)
+		session = StartGeneratorAsAdmin(args...)
+	}
+
+	It("creates the output directory readable by its owner only", func() {
+		StartGenerator("-outputDir", outputDir)
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(FileMode(tmpDir, "output")).To(Equal(os.FileMode(0700)))
+	})
+
+	It("writes secrets readable by their owner only", func() {
+		StartGenerator("-outputDir", outputDir)
+		Eventually(session).Should(gexec.Exit(0))
+
+		for _, name := range []string{"install.bat", "install.ps1", "consul_agent.key", "consul_encrypt.key", "bbs_client.key"} {
+			Expect(FileMode(outputDir, name)).To(Equal(os.FileMode(0600)), name)
+		}
+		for _, name := range []string{"consul_ca.crt", "consul_agent.crt", "bbs_ca.crt", "bbs_client.crt"} {
+			Expect(FileMode(outputDir, name)).To(Equal(os.FileMode(0644)), name)
+		}
+	})
+
+	It("restricts previously written secrets", func() {
+		Expect(os.Mkdir(outputDir, 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(path.Join(outputDir, "bbs_client.key"), []byte("old"), 0644)).To(Succeed())
+
+		StartGenerator("-outputDir", outputDir)
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(FileMode(outputDir, "bbs_client.key")).To(Equal(os.FileMode(0600)))
+	})
+
+	Context("with a world-writable output directory", func() {
+		BeforeEach(func() {
+			Expect(os.Mkdir(outputDir, 0700)).To(Succeed())
+			Expect(os.Chmod(outputDir, 0777)).To(Succeed())
+		})
+
+		It("refuses to write into it", func() {
+			StartGenerator("-outputDir", outputDir)
+			Eventually(session).Should(gexec.Exit(6))
+			Expect(session.Err).Should(gbytes.Say("refusing to write secrets into a world-writable directory"))
+
+			files, err := ioutil.ReadDir(outputDir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(BeEmpty())
+		})
+
+		It("writes into it with -force", func() {
+			StartGenerator("-outputDir", outputDir, "-force")
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(FileMode(outputDir, "bbs_client.key")).To(Equal(os.FileMode(0600)))
+		})
+	})
+
+	It("marks secrets in the zip archive", func() {
+		zipFile := path.Join(tmpDir, "cell.zip")
+		StartGenerator("-outputZip", zipFile)
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(FileMode(tmpDir, "cell.zip")).To(Equal(os.FileMode(0600)))
+
+		reader, err := zip.OpenReader(zipFile)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		modes := map[string]os.FileMode{}
+		for _, file := range reader.File {
+			modes[file.Name] = file.Mode().Perm()
+		}
+		Expect(modes["bbs_client.key"]).To(Equal(os.FileMode(0600)))
+		Expect(modes["bbs_ca.crt"]).To(Equal(os.FileMode(0644)))
+	})
+})
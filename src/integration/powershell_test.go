@@ -0,0 +1,149 @@
+package integration_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"text/template"
+
+	"models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+	"github.com/onsi/gomega/ghttp"
+)
+
+func ExpectedPowershellContent(args models.InstallerArguments) string {
+	content := `$ErrorActionPreference = "Stop"
+
+function Install-Msi {
+    param(
+        [string]$Msi,
+        [System.Collections.Specialized.OrderedDictionary]$Properties
+    )
+
+    $msiPath = Join-Path $PSScriptRoot $Msi
+    $logPath = Join-Path $PSScriptRoot ([System.IO.Path]::GetFileNameWithoutExtension($Msi) + ".log")
+
+    # msiexec expects quoted values, "" is an escaped quote in PowerShell strings.
+    # Only status messages, warnings and errors are logged, verbose logs list
+    # the properties with the admin password and the shared secret.
+    $arguments = @("/passive", "/norestart", "/i", """$msiPath""", "/liwe", """$logPath""")
+    foreach ($property in $Properties.GetEnumerator()) {
+        $arguments += "$($property.Key)=""$($property.Value)"""
+    }
+
+    Write-Host "Installing $Msi, logging to $logPath"
+    $process = Start-Process -FilePath "msiexec.exe" -ArgumentList $arguments -Wait -PassThru
+
+    # 3010: the installation succeeded but a reboot is required
+    if ($process.ExitCode -ne 0 -and $process.ExitCode -ne 3010) {
+        $host.UI.WriteErrorLine("Installing $Msi failed with exit code $($process.ExitCode), see $logPath")
+        exit $process.ExitCode
+    }
+}
+
+$diegoProperties = [ordered]@{ {{ if .BbsRequireSsl }}
+    BBS_CA_FILE = (Join-Path $PSScriptRoot 'bbs_ca.crt')
+    BBS_CLIENT_CERT_FILE = (Join-Path $PSScriptRoot 'bbs_client.crt')
+    BBS_CLIENT_KEY_FILE = (Join-Path $PSScriptRoot 'bbs_client.key'){{ end }}
+    CONSUL_IPS = '127.0.0.1'
+    CF_ETCD_CLUSTER = '{{if .EtcdCluster }}{{.EtcdCluster}}{{else}}http://etcd1.foo.bar:4001{{end}}'
+    STACK = '{{if .Stack }}{{.Stack}}{{else}}windows2012R2{{end}}'
+    REDUNDANCY_ZONE = '{{if .Zone }}{{.Zone}}{{else}}zone1{{end}}'
+    LOGGREGATOR_SHARED_SECRET = 'secret123'
+    MACHINE_IP = '{{if .MachineIp }}{{.MachineIp}}{{else}}127.0.0.1{{end}}'{{ if .SyslogHostIP }}
+    SYSLOG_HOST_IP = 'logs2.test.com'
+    SYSLOG_PORT = '11111'{{ end }}{{ if .ConsulRequireSSL }}
+    CONSUL_ENCRYPT_FILE = (Join-Path $PSScriptRoot 'consul_encrypt.key')
+    CONSUL_CA_FILE = (Join-Path $PSScriptRoot 'consul_ca.crt')
+    CONSUL_AGENT_CERT_FILE = (Join-Path $PSScriptRoot 'consul_agent.crt')
+    CONSUL_AGENT_KEY_FILE = (Join-Path $PSScriptRoot 'consul_agent.key'){{ end }}{{ if .EtcdRequireSSL }}
+    ETCD_CA_FILE = (Join-Path $PSScriptRoot 'etcd_ca.crt')
+    ETCD_CERT_FILE = (Join-Path $PSScriptRoot 'etcd_client.crt')
+    ETCD_KEY_FILE = (Join-Path $PSScriptRoot 'etcd_client.key'){{ end }}
+}{{ if ne .Stack "windows2016" }}
+
+$gardenProperties = [ordered]@{
+    ADMIN_USERNAME = '{{.Username}}'
+    ADMIN_PASSWORD = {{.Password}}
+    MACHINE_IP = '{{if .MachineIp }}{{.MachineIp}}{{else}}127.0.0.1{{end}}'{{ if .SyslogHostIP }}
+    SYSLOG_HOST_IP = 'logs2.test.com'
+    SYSLOG_PORT = '11111'{{ end }}
+}{{ end }}
+
+Install-Msi -Msi "DiegoWindows.msi" -Properties $diegoProperties{{ if ne .Stack "windows2016" }}
+Install-Msi -Msi "GardenWindows.msi" -Properties $gardenProperties{{ end }}`
+	content = strings.Replace(content, "\n", "\r\n", -1)
+	temp := template.Must(template.New("").Parse(content))
+	buf := bytes.NewBufferString("")
+	err := temp.Execute(buf, args)
+	if err != nil {
+		panic(err)
+	}
+	return buf.String()
+}
+
+var _ = Describe("PowerShell installer", func() {
+	var outputDir string
+	var server *ghttp.Server
+	var session *gexec.Session
+	var password string
+	var script string
+
+	UseTempDir(&outputDir)
+
+	BeforeEach(func() {
+		password = "password"
+	})
+
+	JustBeforeEach(func() {
+		server = CreateServer("syslog_manifest.yml", DefaultIndexDeployment())
+		session = StartGeneratorWithArgs(
+			"-boshUrl", server.URL(),
+			"-outputDir", outputDir,
+			"-windowsUsername", "admin",
+			"-windowsPassword", password,
+			"-skipCertValidation",
+			"-machineIp", "10.10.3.21",
+		)
+		Eventually(session).Should(gexec.Exit(0))
+
+		content, err := ioutil.ReadFile(path.Join(outputDir, "install.ps1"))
+		Expect(err).NotTo(HaveOccurred())
+		script = strings.TrimSpace(string(content))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("contains all the MSI parameters", func() {
+		Expect(script).To(Equal(ExpectedPowershellContent(models.InstallerArguments{
+			ConsulRequireSSL: true,
+			SyslogHostIP:     "logs2.test.com",
+			BbsRequireSsl:    true,
+			Username:         "admin",
+			Password:         `'password'`,
+			MachineIp:        "10.10.3.21",
+		})))
+	})
+
+	It("still generates the batch script", func() {
+		_, err := os.Stat(path.Join(outputDir, "install.bat"))
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Context("with special characters in the password", func() {
+		BeforeEach(func() {
+			password = "pa$$word`~!@#^&*()'%;"
+		})
+
+		It("quotes the password as a PowerShell literal", func() {
+			Expect(script).To(ContainSubstring("ADMIN_PASSWORD = 'pa$$word`~!@#^&*()''%;'\r\n"))
+		})
+	})
+})
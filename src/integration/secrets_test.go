@@ -0,0 +1,79 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("Secrets file", func() {
+	var outputDir string
+	var session *gexec.Session
+
+	UseTempDir(&outputDir)
+
+	StartGenerator := func(extraArgs ...string) {
+		args := append([]string{
+			"-manifest", "one_zone_manifest.yml",
+			"-outputDir", outputDir,
+			"-windowsUsername", "admin",
+			"-windowsPassword", "pass%wo&rd",
+			"-skipCertValidation",
+			"-machineIp", "127.0.0.1",
+			"-secretsFile",
+		}, extraArgs...)
+		session = StartGeneratorWithArgs(args...)
+		Eventually(session).Should(gexec.Exit(0))
+	}
+
+	It("keeps the secrets out of the install scripts", func() {
+		StartGenerator()
+
+		for _, script := range []string{"install.bat", "install.ps1"} {
+			Expect(ReadOutputFile(outputDir, script)).NotTo(ContainSubstring("secret123"))
+			Expect(ReadOutputFile(outputDir, script)).NotTo(ContainSubstring("pass%wo&rd"))
+			Expect(ReadOutputFile(outputDir, script)).NotTo(ContainSubstring("pass%%wo&rd"))
+			Expect(FileMode(outputDir, script)).To(Equal(os.FileMode(0644)))
+		}
+	})
+
+	It("reads and deletes the secrets in install.bat", func() {
+		StartGenerator()
+
+		script := ReadOutputFile(outputDir, "install.bat")
+		Expect(script).To(ContainSubstring("call %~dp0\\install_secrets.bat\r\ndel %~dp0\\install_secrets.bat\r\n"))
+		Expect(script).To(ContainSubstring("LOGGREGATOR_SHARED_SECRET=%LOGGREGATOR_SHARED_SECRET% ^"))
+		Expect(script).To(ContainSubstring(`ADMIN_PASSWORD="""%ADMIN_PASSWORD%""" ^`))
+		Expect(script).NotTo(ContainSubstring("echo on"))
+
+		Expect(ReadOutputFile(outputDir, "install_secrets.bat")).To(Equal("set \"LOGGREGATOR_SHARED_SECRET=secret123\"\r\n" +
+			`set "ADMIN_PASSWORD=pass%%wo&rd"`))
+		Expect(FileMode(outputDir, "install_secrets.bat")).To(Equal(os.FileMode(0600)))
+	})
+
+	It("reads and deletes the secrets in install.ps1", func() {
+		StartGenerator()
+
+		script := ReadOutputFile(outputDir, "install.ps1")
+		Expect(script).To(ContainSubstring("$secrets = Get-Content -Raw $secretsPath | ConvertFrom-Json\r\nRemove-Item $secretsPath\r\n"))
+		Expect(script).To(ContainSubstring("LOGGREGATOR_SHARED_SECRET = $secrets.LOGGREGATOR_SHARED_SECRET\r\n"))
+		Expect(script).To(ContainSubstring("ADMIN_PASSWORD = $secrets.ADMIN_PASSWORD\r\n"))
+
+		secrets := map[string]string{}
+		Expect(json.Unmarshal([]byte(ReadOutputFile(outputDir, "install_secrets.json")), &secrets)).To(Succeed())
+		Expect(secrets).To(Equal(map[string]string{
+			"LOGGREGATOR_SHARED_SECRET": "secret123",
+			"ADMIN_PASSWORD":            "pass%wo&rd",
+		}))
+		Expect(FileMode(outputDir, "install_secrets.json")).To(Equal(os.FileMode(0600)))
+	})
+
+	It("omits the admin password on stacks without GardenWindows.msi", func() {
+		StartGenerator("-stack", "windows2016")
+
+		Expect(ReadOutputFile(outputDir, "install_secrets.bat")).To(Equal(`set "LOGGREGATOR_SHARED_SECRET=secret123"`))
+	})
+})
@@ -0,0 +1,79 @@
+package integration_test
+
+import (
+	"models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("Stacks", func() {
+	var outputDir string
+	var session *gexec.Session
+
+	UseTempDir(&outputDir)
+
+	StartGenerator := func(extraArgs ...string) {
+		args := append([]string{
+			"-manifest", "syslog_manifest.yml",
+			"-outputDir", outputDir,
+			"-skipCertValidation",
+			"-machineIp", "127.0.0.1",
+		}, extraArgs...)
+		session = StartGeneratorWithArgs(args...)
+	}
+
+	Context("with the windows2016 stack", func() {
+		BeforeEach(func() {
+			StartGenerator("-stack", "windows2016")
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("does not require windows credentials", func() {
+			Expect(session.Err).NotTo(gbytes.Say("Invalid windowsUsername"))
+		})
+
+		It("only installs DiegoWindows.msi", func() {
+			args := models.InstallerArguments{
+				ConsulRequireSSL: true,
+				SyslogHostIP:     "logs2.test.com",
+				BbsRequireSsl:    true,
+				Stack:            "windows2016",
+			}
+			Expect(ReadOutputFile(outputDir, "install.bat")).To(Equal(ExpectedContent(args)))
+			Expect(ReadOutputFile(outputDir, "install.ps1")).To(Equal(ExpectedPowershellContent(args)))
+			Expect(ReadOutputFile(outputDir, "install.bat")).NotTo(ContainSubstring("GardenWindows.msi"))
+		})
+	})
+
+	Context("with the windows2012R2 stack", func() {
+		BeforeEach(func() {
+			StartGenerator("-stack", "windows2012R2", "-windowsUsername", "admin", "-windowsPassword", "password")
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("installs DiegoWindows.msi and GardenWindows.msi", func() {
+			Expect(ReadOutputFile(outputDir, "install.bat")).To(Equal(ExpectedContent(models.InstallerArguments{
+				ConsulRequireSSL: true,
+				SyslogHostIP:     "logs2.test.com",
+				BbsRequireSsl:    true,
+				Username:         "admin",
+				Password:         `"""password"""`,
+				Stack:            "windows2012R2",
+			})))
+		})
+	})
+
+	Context("with an unknown stack", func() {
+		BeforeEach(func() {
+			StartGenerator("-stack", "windows2008", "-windowsUsername", "admin", "-windowsPassword", "password")
+			Eventually(session).Should(gexec.Exit(1))
+		})
+
+		It("lists the known stacks", func() {
+			Expect(session.Err).Should(gbytes.Say("Invalid stack windows2008, must be one of: windows2012R2, windows2016"))
+		})
+	})
+})
@@ -0,0 +1,132 @@
+package integration_test
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	"github.com/onsi/gomega/ghttp"
+)
+
+func CreateTLSServer(manifest string) *ghttp.Server {
+	yaml, err := ioutil.ReadFile(manifest)
+	Expect(err).ToNot(HaveOccurred())
+
+	server := ghttp.NewTLSServer()
+	server.AppendHandlers(
+		BasicAuthInfoHandler(),
+		ghttp.CombineHandlers(
+			ghttp.VerifyRequest("GET", "/deployments"),
+			ghttp.RespondWithJSONEncoded(200, DefaultIndexDeployment()),
+		),
+		ghttp.CombineHandlers(
+			ghttp.VerifyRequest("GET", "/deployments/cf-warden-diego"),
+			ghttp.RespondWithJSONEncoded(200, models.ShowDeployment{Manifest: string(yaml)}),
+		),
+	)
+
+	return server
+}
+
+var _ = Describe("Director TLS verification", func() {
+	var outputDir string
+	var server *ghttp.Server
+	var session *gexec.Session
+	var serverCA string
+
+	UseTempDir(&outputDir)
+
+	BeforeEach(func() {
+		server = CreateTLSServer("syslog_manifest.yml")
+		serverCA = string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: server.HTTPTestServer.Certificate().Raw,
+		}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	StartGenerator := func(extraArgs ...string) {
+		args := append([]string{
+			"-boshUrl", server.URL(),
+			"-outputDir", outputDir,
+			"-skipCertValidation",
+			"-machineIp", "127.0.0.1",
+		}, extraArgs...)
+		session = StartGeneratorAsAdmin(args...)
+	}
+
+	Context("when the director certificate is not trusted", func() {
+		BeforeEach(func() {
+			StartGenerator()
+			Eventually(session).Should(gexec.Exit(2))
+		})
+
+		It("refuses to connect", func() {
+			Expect(session.Err).Should(gbytes.Say("Unable to establish connection to BOSH Director"))
+			Expect(server.ReceivedRequests()).To(BeEmpty())
+		})
+	})
+
+	Context("with a CA certificate file", func() {
+		BeforeEach(func() {
+			caFile := path.Join(outputDir, "director_ca.crt")
+			Expect(ioutil.WriteFile(caFile, []byte(serverCA), 0644)).To(Succeed())
+			StartGenerator("-caCert", caFile)
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("generates the install script", func() {
+			_, err := os.Stat(path.Join(outputDir, "install.bat"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("with a CA certificate PEM string", func() {
+		BeforeEach(func() {
+			StartGenerator("-caCert", serverCA)
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("generates the install script", func() {
+			_, err := os.Stat(path.Join(outputDir, "install.bat"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("with an invalid CA certificate", func() {
+		BeforeEach(func() {
+			StartGenerator("-caCert", "-----BEGIN CERTIFICATE-----\ngarbage\n-----END CERTIFICATE-----")
+			Eventually(session).Should(gexec.Exit(1))
+		})
+
+		It("displays an error to the user", func() {
+			Expect(session.Err).Should(gbytes.Say("Unable to parse CA certificate"))
+		})
+	})
+
+	Context("with -skipSslValidation", func() {
+		BeforeEach(func() {
+			StartGenerator("-skipSslValidation")
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("warns that the certificate is not verified", func() {
+			Expect(session.Err).Should(gbytes.Say("WARNING: -skipSslValidation is set, the certificates of the BOSH director, UAA, CredHub and Ops Manager will NOT be verified"))
+		})
+
+		It("generates the install script", func() {
+			_, err := os.Stat(path.Join(outputDir, "install.bat"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+})
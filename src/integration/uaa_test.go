@@ -0,0 +1,223 @@
+package integration_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+
+	"models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	"github.com/onsi/gomega/ghttp"
+)
+
+func UAAInfoHandler(uaaUrl string) http.HandlerFunc {
+	info := models.DirectorInfo{}
+	info.UserAuthentication.Type = "uaa"
+	info.UserAuthentication.Options.URL = uaaUrl
+
+	return ghttp.CombineHandlers(
+		ghttp.VerifyRequest("GET", "/info"),
+		ghttp.RespondWithJSONEncoded(200, info),
+	)
+}
+
+func UAATokenHandler(clientID, clientSecret string, form url.Values, token models.UAAToken) http.HandlerFunc {
+	return ghttp.CombineHandlers(
+		ghttp.VerifyRequest("POST", "/oauth/token"),
+		ghttp.VerifyBasicAuth(clientID, clientSecret),
+		ghttp.VerifyForm(form),
+		ghttp.RespondWithJSONEncoded(200, token),
+	)
+}
+
+func CreateUAADirector(uaaUrl string, tokens ...string) *ghttp.Server {
+	yaml, err := ioutil.ReadFile("syslog_manifest.yml")
+	Expect(err).ToNot(HaveOccurred())
+
+	server := ghttp.NewServer()
+	server.AppendHandlers(
+		UAAInfoHandler(uaaUrl),
+		ghttp.CombineHandlers(
+			ghttp.VerifyRequest("GET", "/deployments"),
+			ghttp.VerifyHeaderKV("Authorization", "Bearer "+tokens[0]),
+			ghttp.RespondWithJSONEncoded(200, DefaultIndexDeployment()),
+		),
+		ghttp.CombineHandlers(
+			ghttp.VerifyRequest("GET", "/deployments/cf-warden-diego"),
+			ghttp.VerifyHeaderKV("Authorization", "Bearer "+tokens[len(tokens)-1]),
+			ghttp.RespondWithJSONEncoded(200, models.ShowDeployment{Manifest: string(yaml)}),
+		),
+	)
+
+	return server
+}
+
+var _ = Describe("UAA authentication", func() {
+	var outputDir string
+	var uaa *ghttp.Server
+	var director *ghttp.Server
+	var session *gexec.Session
+
+	UseTempDir(&outputDir)
+
+	BeforeEach(func() {
+		uaa = ghttp.NewServer()
+	})
+
+	AfterEach(func() {
+		uaa.Close()
+		director.Close()
+	})
+
+	Context("with client credentials", func() {
+		BeforeEach(func() {
+			uaa.AppendHandlers(
+				UAATokenHandler("director-client", "client-secret",
+					url.Values{"grant_type": {"client_credentials"}},
+					models.UAAToken{AccessToken: "client-token", ExpiresIn: 3600},
+				),
+			)
+			director = CreateUAADirector(uaa.URL(), "client-token")
+
+			session = StartGeneratorAsAdmin(
+				"-boshUrl", director.URL(),
+				"-boshClient", "director-client",
+				"-boshClientSecret", "client-secret",
+				"-outputDir", outputDir,
+				"-skipCertValidation",
+				"-machineIp", "127.0.0.1",
+			)
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("sends the bearer token on every director request", func() {
+			Expect(uaa.ReceivedRequests()).To(HaveLen(1))
+			Expect(director.ReceivedRequests()).To(HaveLen(3))
+		})
+
+		It("generates the install script", func() {
+			_, err := os.Stat(path.Join(outputDir, "install.bat"))
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("with a username and password in the BOSH URL", func() {
+		BeforeEach(func() {
+			uaa.AppendHandlers(
+				UAATokenHandler("bosh_cli", "",
+					url.Values{"grant_type": {"password"}, "username": {"admin"}, "password": {"secret"}},
+					models.UAAToken{AccessToken: "first-token", RefreshToken: "refresh-token", ExpiresIn: 0},
+				),
+				UAATokenHandler("bosh_cli", "",
+					url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"refresh-token"}},
+					models.UAAToken{AccessToken: "refreshed-token", RefreshToken: "refresh-token", ExpiresIn: 3600},
+				),
+			)
+			director = CreateUAADirector(uaa.URL(), "first-token", "refreshed-token")
+
+			directorUrl, err := url.Parse(director.URL())
+			Expect(err).NotTo(HaveOccurred())
+			directorUrl.User = url.UserPassword("admin", "secret")
+
+			session = StartGeneratorAsAdmin(
+				"-boshUrl", directorUrl.String(),
+				"-outputDir", outputDir,
+				"-skipCertValidation",
+				"-machineIp", "127.0.0.1",
+			)
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("refreshes the token once it expires", func() {
+			Expect(uaa.ReceivedRequests()).To(HaveLen(2))
+			Expect(director.ReceivedRequests()).To(HaveLen(3))
+		})
+
+		It("does not send basic auth credentials to the director", func() {
+			for _, request := range director.ReceivedRequests()[1:] {
+				_, _, ok := request.BasicAuth()
+				Expect(ok).To(BeFalse())
+			}
+		})
+	})
+
+	Context("when the UAA rejects the credentials", func() {
+		BeforeEach(func() {
+			uaa.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/oauth/token"),
+					ghttp.RespondWith(401, `{"error":"unauthorized"}`),
+				),
+			)
+			director = ghttp.NewServer()
+			director.AppendHandlers(UAAInfoHandler(uaa.URL()))
+
+			session = StartGeneratorAsAdmin(
+				"-boshUrl", director.URL(),
+				"-boshClient", "director-client",
+				"-boshClientSecret", "wrong-secret",
+				"-outputDir", outputDir,
+			)
+			Eventually(session).Should(gexec.Exit(3))
+		})
+
+		It("displays the error to the user", func() {
+			Expect(session.Err).Should(gbytes.Say("Unable to authenticate with UAA"))
+		})
+	})
+
+	Context("when the UAA response is not a token", func() {
+		StartGeneratorWithTokenResponse := func(body string) {
+			uaa.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/oauth/token"),
+					ghttp.RespondWith(200, body),
+				),
+			)
+			director = ghttp.NewServer()
+			director.AppendHandlers(UAAInfoHandler(uaa.URL()))
+
+			session = StartGeneratorAsAdmin(
+				"-boshUrl", director.URL(),
+				"-boshClient", "director-client",
+				"-boshClientSecret", "client-secret",
+				"-outputDir", outputDir,
+			)
+		}
+
+		It("reports invalid JSON as a server failure", func() {
+			StartGeneratorWithTokenResponse("<html>Maintenance</html>")
+			Eventually(session).Should(gexec.Exit(2))
+			Expect(session.Err).Should(gbytes.Say("Unable to establish connection to UAA. invalid UAA response"))
+		})
+
+		It("reports a missing access token as an authentication failure", func() {
+			StartGeneratorWithTokenResponse(`{"token_type":"bearer"}`)
+			Eventually(session).Should(gexec.Exit(3))
+			Expect(session.Err).Should(gbytes.Say("UAA response did not contain an access token"))
+		})
+	})
+
+	Context("when no credentials are given", func() {
+		BeforeEach(func() {
+			director = ghttp.NewServer()
+			director.AppendHandlers(UAAInfoHandler(uaa.URL()))
+
+			session = StartGeneratorAsAdmin(
+				"-boshUrl", director.URL(),
+				"-outputDir", outputDir,
+			)
+			Eventually(session).Should(gexec.Exit(3))
+		})
+
+		It("asks for credentials", func() {
+			Expect(session.Err).Should(gbytes.Say("BOSH Director uses UAA authentication"))
+		})
+	})
+})
@@ -0,0 +1,81 @@
+package integration_test
+
+import (
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("Uninstall scripts", func() {
+	var outputDir string
+
+	UseTempDir(&outputDir)
+
+	Generate := func(extraArgs ...string) {
+		session := StartGeneratorAsAdmin(append([]string{
+			"-manifest", "one_zone_manifest.yml",
+			"-outputDir", outputDir,
+			"-skipCertValidation",
+			"-machineIp", "127.0.0.1",
+		}, extraArgs...)...)
+		Eventually(session).Should(gexec.Exit(0))
+	}
+
+	Context("on windows2012R2", func() {
+		BeforeEach(func() {
+			Generate()
+		})
+
+		It("removes DiegoWindows before GardenWindows", func() {
+			script := ReadOutputFile(outputDir, "uninstall.bat")
+			Expect(script).To(ContainSubstring("net stop %%s"))
+			Expect(script).To(MatchRegexp(`(?s)name='DiegoWindows'.*name='GardenWindows'`))
+
+			ps1 := ReadOutputFile(outputDir, "uninstall.ps1")
+			Expect(ps1).To(ContainSubstring("Stop-Service -Name $service"))
+			Expect(ps1).To(MatchRegexp(`(?s)Uninstall-Msi -Name "DiegoWindows"\r\nUninstall-Msi -Name "GardenWindows"`))
+		})
+
+		It("stops the Diego and Garden services", func() {
+			Expect(ReadOutputFile(outputDir, "uninstall.bat")).To(ContainSubstring("(RepService MetronService ConsulService ContainerizerService GardenWindowsService)"))
+		})
+
+		It("removes the certificates, keys and containers on cleanup", func() {
+			script := ReadOutputFile(outputDir, "uninstall.bat")
+			Expect(script).To(ContainSubstring(`if /i not "%~1"=="/cleanup" exit /b 0`))
+			for _, name := range []string{"consul_ca.crt", "consul_agent.crt", "consul_agent.key", "consul_encrypt.key", "bbs_ca.crt", "bbs_client.crt", "bbs_client.key"} {
+				Expect(script).To(ContainSubstring(`del /q "%~dp0\` + name + `" 2>nul`))
+			}
+			Expect(script).NotTo(ContainSubstring("install.bat"))
+			Expect(script).To(ContainSubstring(`rmdir /s /q "C:\containerizer"`))
+
+			Expect(ReadOutputFile(outputDir, "uninstall.ps1")).To(ContainSubstring(`foreach ($file in @('consul_ca.crt', 'consul_agent.crt', 'consul_agent.key', 'consul_encrypt.key', 'bbs_ca.crt', 'bbs_client.crt', 'bbs_client.key'))`))
+		})
+
+		It("is not secret", func() {
+			for _, name := range []string{"uninstall.bat", "uninstall.ps1"} {
+				info, err := os.Stat(path.Join(outputDir, name))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(info.Mode().Perm()).To(Equal(os.FileMode(0644)))
+			}
+		})
+	})
+
+	It("leaves GardenWindows alone on windows2016", func() {
+		Generate("-stack", "windows2016")
+
+		script := ReadOutputFile(outputDir, "uninstall.bat")
+		Expect(script).To(ContainSubstring("(RepService MetronService ConsulService)"))
+		Expect(script).NotTo(ContainSubstring("GardenWindows"))
+		Expect(ReadOutputFile(outputDir, "uninstall.ps1")).NotTo(ContainSubstring("GardenWindows"))
+	})
+
+	It("removes the given containers directory", func() {
+		Generate("-containersDir", `D:\containers`)
+		Expect(ReadOutputFile(outputDir, "uninstall.bat")).To(ContainSubstring(`rmdir /s /q "D:\containers"`))
+		Expect(ReadOutputFile(outputDir, "uninstall.ps1")).To(ContainSubstring(`Remove-Item -Recurse -Force 'D:\containers'`))
+	})
+})
@@ -0,0 +1,143 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("Upgrade mode", func() {
+	var outputDir string
+
+	UseTempDir(&outputDir)
+
+	StartGenerator := func(dir string, extraArgs ...string) *gexec.Session {
+		return StartGeneratorAsAdmin(append([]string{
+			"-manifest", "one_zone_manifest.yml",
+			"-outputDir", dir,
+			"-skipCertValidation",
+			"-machineIp", "127.0.0.1",
+		}, extraArgs...)...)
+	}
+
+	ReadParameters := func() map[string]string {
+		content, err := ioutil.ReadFile(path.Join(outputDir, "install_params.json"))
+		Expect(err).NotTo(HaveOccurred())
+		parameters := map[string]string{}
+		Expect(json.Unmarshal(content, &parameters)).To(Succeed())
+		return parameters
+	}
+
+	It("generates no upgrade scripts in install mode", func() {
+		Eventually(StartGenerator(outputDir)).Should(gexec.Exit(0))
+		for _, name := range []string{"install_params.json", "upgrade.bat", "upgrade.ps1"} {
+			Expect(path.Join(outputDir, name)).NotTo(BeAnExistingFile())
+		}
+	})
+
+	Context("with -mode upgrade", func() {
+		BeforeEach(func() {
+			Eventually(StartGenerator(outputDir, "-mode", "upgrade")).Should(gexec.Exit(0))
+		})
+
+		It("records the parameters of the installation", func() {
+			parameters := ReadParameters()
+			Expect(parameters).To(HaveKeyWithValue("MACHINE_IP", "127.0.0.1"))
+			Expect(parameters).To(HaveKeyWithValue("CONSUL_IPS", "127.0.0.1"))
+			Expect(parameters).To(HaveKeyWithValue("STACK", "windows2012R2"))
+			Expect(parameters).To(HaveKeyWithValue("ADMIN_USERNAME", "admin"))
+			Expect(parameters).To(HaveKey("bbs_client.crt"))
+		})
+
+		It("records keys by their digest and no digest of the passwords", func() {
+			parameters := ReadParameters()
+			for _, name := range []string{"bbs_client.key", "consul_encrypt.key"} {
+				Expect(parameters[name]).To(MatchRegexp("^sha256:[0-9a-f]{64}$"))
+			}
+			Expect(parameters).To(HaveKeyWithValue("LOGGREGATOR_SHARED_SECRET", "(not recorded)"))
+			Expect(parameters).To(HaveKeyWithValue("ADMIN_PASSWORD", "(not recorded)"))
+
+			content, err := ioutil.ReadFile(path.Join(outputDir, "install_params.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).NotTo(ContainSubstring("secret123"))
+			Expect(string(content)).NotTo(ContainSubstring("password\""))
+		})
+
+		It("reinstalls from the upgrade script only on changes", func() {
+			bat, err := ioutil.ReadFile(path.Join(outputDir, "upgrade.bat"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(bat)).To(ContainSubstring(`-File "%~dp0\upgrade.ps1"`))
+
+			ps1, err := ioutil.ReadFile(path.Join(outputDir, "upgrade.ps1"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(ps1)).To(ContainSubstring("@('DiegoWindows.msi', 'GardenWindows.msi', 'install.ps1')"))
+			Expect(string(ps1)).To(MatchRegexp(`(?s)if \(\$changes.Count -eq 0\) \{.*exit 0.*uninstall.ps1.*install.ps1`))
+		})
+
+		It("records secrets on the cell as HMACs readable by administrators only", func() {
+			ps1, err := ioutil.ReadFile(path.Join(outputDir, "upgrade.ps1"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(ps1)).To(ContainSubstring("System.Security.Cryptography.HMACSHA256"))
+			Expect(string(ps1)).To(ContainSubstring("[System.Security.Cryptography.RandomNumberGenerator]::Create().GetBytes($key)"))
+			Expect(string(ps1)).To(ContainSubstring(`icacls $Path /inheritance:r /grant:r "*S-1-5-32-544:${Inheritance}F" "*S-1-5-18:${Inheritance}F"`))
+			Expect(string(ps1)).To(MatchRegexp(`(?s)\$protected \| ConvertTo-Json \| Set-Content \$recordPath.*Protect-Path \$recordPath`))
+			Expect(string(ps1)).NotTo(ContainSubstring("$parameters | ConvertTo-Json"))
+		})
+
+		It("compares the secrets on the cell by the files holding them", func() {
+			session := StartGenerator(outputDir, "-mode", "upgrade", "-secretsFile")
+			Eventually(session).Should(gexec.Exit(0))
+
+			ps1, err := ioutil.ReadFile(path.Join(outputDir, "upgrade.ps1"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(ps1)).To(ContainSubstring("@('DiegoWindows.msi', 'GardenWindows.msi', 'install.ps1', 'install_secrets.json')"))
+		})
+
+		It("keeps the parameters secret", func() {
+			info, err := os.Stat(path.Join(outputDir, "install_params.json"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+			info, err = os.Stat(path.Join(outputDir, "upgrade.ps1"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(info.Mode().Perm()).To(Equal(os.FileMode(0644)))
+		})
+
+		Context("with -previousParams", func() {
+			var newDir string
+
+			UseTempDir(&newDir)
+
+			It("prints the changes", func() {
+				session := StartGenerator(newDir, "-mode", "upgrade", "-machineIp", "10.0.0.2", "-windowsPassword", "new-password", "-previousParams", path.Join(outputDir, "install_params.json"))
+				Eventually(session).Should(gexec.Exit(0))
+				Expect(session.Out).To(gbytes.Say("Changes since .*install_params.json:"))
+				Expect(session.Out).To(gbytes.Say("  MACHINE_IP: 127.0.0.1 -> 10.0.0.2"))
+				Expect(session.Out).NotTo(gbytes.Say("ADMIN_PASSWORD"))
+				Expect(session.Out).NotTo(gbytes.Say("new-password"))
+			})
+
+			It("reports when nothing changed", func() {
+				session := StartGenerator(newDir, "-mode", "upgrade", "-previousParams", path.Join(outputDir, "install_params.json"))
+				Eventually(session).Should(gexec.Exit(0))
+				Expect(session.Out).To(gbytes.Say("No changes since"))
+			})
+		})
+	})
+
+	It("requires -mode upgrade for -previousParams", func() {
+		session := StartGenerator(outputDir, "-previousParams", "install_params.json")
+		Eventually(session).Should(gexec.Exit(1))
+	})
+
+	It("rejects unknown modes", func() {
+		session := StartGenerator(outputDir, "-mode", "reinstall")
+		Eventually(session).Should(gexec.Exit(1))
+	})
+})
@@ -0,0 +1,236 @@
+package integration_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+	"github.com/onsi/gomega/ghttp"
+)
+
+func CredHubDataHandler(credentials map[string]interface{}) http.HandlerFunc {
+	return ghttp.CombineHandlers(
+		ghttp.VerifyHeaderKV("Authorization", "Bearer credhub-token"),
+		func(w http.ResponseWriter, req *http.Request) {
+			Expect(req.URL.Query().Get("current")).To(Equal("true"))
+
+			name := req.URL.Query().Get("name")
+			value, ok := credentials[name]
+			if !ok {
+				ghttp.RespondWith(404, `{"error":"The request could not be completed because the credential does not exist or you do not have sufficient authorization."}`)(w, req)
+				return
+			}
+
+			ghttp.RespondWithJSONEncoded(200, models.CredHubData{
+				Data: []models.CredHubCredential{{Name: name, Value: value}},
+			})(w, req)
+		},
+	)
+}
+
+var _ = Describe("Manifest variables", func() {
+	var outputDir string
+	var session *gexec.Session
+
+	UseTempDir(&outputDir)
+
+	StartGenerator := func(extraArgs ...string) {
+		args := append([]string{
+			"-manifest", "variables_manifest.yml",
+			"-outputDir", outputDir,
+			"-skipCertValidation",
+			"-machineIp", "127.0.0.1",
+		}, extraArgs...)
+		session = StartGeneratorAsAdmin(args...)
+	}
+
+	ExpectedScript := func() string {
+		return ExpectedContent(models.InstallerArguments{
+			ConsulRequireSSL: true,
+			SyslogHostIP:     "logs2.test.com",
+			BbsRequireSsl:    true,
+			Username:         "admin",
+			Password:         `"""password"""`,
+		})
+	}
+
+	Context("with a vars store and command line variables", func() {
+		BeforeEach(func() {
+			StartGenerator(
+				"-vars-store", "vars_store.yml",
+				"-v", "metron_secret=secret123",
+				"-v", "etcd_host=etcd1.foo.bar",
+			)
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("prefers command line variables over the vars store", func() {
+			Expect(ReadOutputFile(outputDir, "install.bat")).To(Equal(ExpectedScript()))
+		})
+
+		It("resolves the certificate fields", func() {
+			Expect(ReadOutputFile(outputDir, "consul_ca.crt")).To(Equal("CONSUL_CA_CERT"))
+			Expect(ReadOutputFile(outputDir, "consul_agent.crt")).To(Equal("CONSUL_AGENT_CERT"))
+			Expect(ReadOutputFile(outputDir, "consul_agent.key")).To(Equal("CONSUL_AGENT_KEY"))
+			Expect(ReadOutputFile(outputDir, "consul_encrypt.key")).To(Equal("mBevws9TpU1sFPHK/Fq0IQ=="))
+			Expect(ReadOutputFile(outputDir, "bbs_ca.crt")).To(Equal("BBS_CA_CERT"))
+			Expect(ReadOutputFile(outputDir, "bbs_client.crt")).To(Equal("BBS_CLIENT_CERT"))
+			Expect(ReadOutputFile(outputDir, "bbs_client.key")).To(Equal("BBS_CLIENT_KEY"))
+		})
+	})
+
+	Context("when variables cannot be resolved", func() {
+		BeforeEach(func() {
+			StartGenerator("-v", "metron_secret=secret123")
+			Eventually(session).Should(gexec.Exit(5))
+		})
+
+		It("lists the missing variables", func() {
+			Expect(session.Err).Should(gbytes.Say("Could not resolve manifest variables: bbs_client, consul_agent_cert, consul_encrypt_key, etcd_host"))
+		})
+
+		It("does not write the placeholders to the output files", func() {
+			_, err := os.Stat(path.Join(outputDir, "consul_ca.crt"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+
+	Context("with a variable that lacks the requested field", func() {
+		BeforeEach(func() {
+			StartGenerator(
+				"-vars-store", "vars_store.yml",
+				"-v", "etcd_host=etcd1.foo.bar",
+				"-v", "bbs_client=not-a-certificate",
+			)
+			Eventually(session).Should(gexec.Exit(5))
+		})
+
+		It("names the missing field", func() {
+			Expect(session.Err).Should(gbytes.Say("bbs_client.ca"))
+		})
+	})
+
+	Context("with placeholders for booleans and lists", func() {
+		StartGeneratorWithTypedPlaceholders := func(extraArgs ...string) {
+			content, err := ioutil.ReadFile("variables_manifest.yml")
+			Expect(err).NotTo(HaveOccurred())
+			manifest := strings.NewReplacer(
+				"    require_ssl: true\n    agent_cert", "    require_ssl: ((consul_ssl))\n    agent_cert",
+				"        lan:\n          - 127.0.0.1", "        lan: ((consul_ips))",
+			).Replace(string(content))
+			Expect(manifest).To(ContainSubstring("((consul_ssl))"))
+			Expect(manifest).To(ContainSubstring("((consul_ips))"))
+
+			manifestFile := path.Join(outputDir, "manifest.yml")
+			Expect(ioutil.WriteFile(manifestFile, []byte(manifest), 0600)).To(Succeed())
+			vars, err := ioutil.ReadFile("vars_store.yml")
+			Expect(err).NotTo(HaveOccurred())
+			varsFile := path.Join(outputDir, "vars.yml")
+			Expect(ioutil.WriteFile(varsFile, append(vars, "consul_ips:\n  - 127.0.0.1\n"...), 0600)).To(Succeed())
+
+			session = StartGeneratorAsAdmin(append([]string{
+				"-manifest", manifestFile,
+				"-outputDir", path.Join(outputDir, "scripts"),
+				"-skipCertValidation",
+				"-machineIp", "127.0.0.1",
+				"-vars-store", varsFile,
+				"-v", "metron_secret=secret123",
+				"-v", "etcd_host=etcd1.foo.bar",
+			}, extraArgs...)...)
+		}
+
+		It("resolves them before decoding the manifest", func() {
+			StartGeneratorWithTypedPlaceholders("-v", "consul_ssl=true")
+			Eventually(session).Should(gexec.Exit(0))
+			Expect(ReadOutputFile(outputDir, "scripts/install.bat")).To(Equal(ExpectedScript()))
+		})
+
+		It("rejects values of the wrong type", func() {
+			StartGeneratorWithTypedPlaceholders("-v", "consul_ssl=maybe")
+			Eventually(session).Should(gexec.Exit(5))
+		})
+	})
+
+	It("reports an invalid CredHub response as a server failure", func() {
+		credhub := ghttp.NewServer()
+		defer credhub.Close()
+		credhub.RouteToHandler("GET", "/info", ghttp.RespondWith(200, "<html>Maintenance</html>"))
+
+		StartGenerator(
+			"-credhubUrl", credhub.URL(),
+			"-credhubClient", "credhub-client",
+			"-credhubClientSecret", "credhub-secret",
+			"-directorName", "my-director",
+		)
+		Eventually(session).Should(gexec.Exit(2))
+		Expect(session.Err).Should(gbytes.Say("Unable to establish connection to CredHub. invalid CredHub response"))
+	})
+
+	Context("with CredHub", func() {
+		var credhub, uaa *ghttp.Server
+
+		BeforeEach(func() {
+			uaa = ghttp.NewServer()
+			uaa.AppendHandlers(
+				UAATokenHandler("credhub-client", "credhub-secret",
+					url.Values{"grant_type": {"client_credentials"}},
+					models.UAAToken{AccessToken: "credhub-token", ExpiresIn: 3600},
+				),
+			)
+
+			prefix := "/my-director/cf-warden-diego/"
+			credhub = ghttp.NewServer()
+			credhub.RouteToHandler("GET", "/info", ghttp.RespondWithJSONEncoded(200, map[string]interface{}{
+				"auth-server": map[string]string{"url": uaa.URL()},
+			}))
+			credhub.RouteToHandler("GET", "/api/v1/data", CredHubDataHandler(map[string]interface{}{
+				prefix + "consul_agent_cert": map[string]string{
+					"ca":          "CONSUL_CA_CERT",
+					"certificate": "CONSUL_AGENT_CERT",
+					"private_key": "CONSUL_AGENT_KEY",
+				},
+				prefix + "consul_encrypt_key": "mBevws9TpU1sFPHK/Fq0IQ==",
+				prefix + "bbs_client": map[string]string{
+					"ca":          "BBS_CA_CERT",
+					"certificate": "BBS_CLIENT_CERT",
+					"private_key": "BBS_CLIENT_KEY",
+				},
+				prefix + "etcd_host":     "etcd1.foo.bar",
+				prefix + "metron_secret": "secret123",
+			}))
+
+			StartGenerator(
+				"-credhubUrl", credhub.URL(),
+				"-credhubClient", "credhub-client",
+				"-credhubClientSecret", "credhub-secret",
+				"-directorName", "my-director",
+			)
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		AfterEach(func() {
+			credhub.Close()
+			uaa.Close()
+		})
+
+		It("resolves the variables below the deployment namespace", func() {
+			Expect(ReadOutputFile(outputDir, "install.bat")).To(Equal(ExpectedScript()))
+			Expect(ReadOutputFile(outputDir, "bbs_client.key")).To(Equal("BBS_CLIENT_KEY"))
+			Expect(ReadOutputFile(outputDir, "consul_agent.crt")).To(Equal("CONSUL_AGENT_CERT"))
+		})
+
+		It("only looks up the variables the generator needs", func() {
+			Expect(uaa.ReceivedRequests()).To(HaveLen(1))
+			Expect(credhub.ReceivedRequests()).To(HaveLen(6))
+		})
+	})
+})
@@ -0,0 +1,139 @@
+package integration_test
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("Zip output", func() {
+	var tmpDir, zipFile string
+	var session *gexec.Session
+
+	UseTempDir(&tmpDir)
+
+	BeforeEach(func() {
+		zipFile = path.Join(tmpDir, "cell.zip")
+	})
+
+	StartGenerator := func(extraArgs ...string) {
+		args := append([]string{
+			"-manifest", "one_zone_manifest.yml",
+			"-outputZip", zipFile,
+			"-skipCertValidation",
+			"-machineIp", "127.0.0.1",
+		}, extraArgs...)
+		session = StartGeneratorAsAdmin(args...)
+	}
+
+	ReadZip := func() map[string][]byte {
+		reader, err := zip.OpenReader(zipFile)
+		Expect(err).NotTo(HaveOccurred())
+		defer reader.Close()
+
+		files := map[string][]byte{}
+		for _, file := range reader.File {
+			r, err := file.Open()
+			Expect(err).NotTo(HaveOccurred())
+			content, err := ioutil.ReadAll(r)
+			Expect(err).NotTo(HaveOccurred())
+			r.Close()
+			files[file.Name] = content
+		}
+		return files
+	}
+
+	ReadContents := func(files map[string][]byte) models.BundleContents {
+		contents := models.BundleContents{}
+		Expect(json.Unmarshal(files["contents.json"], &contents)).To(Succeed())
+		return contents
+	}
+
+	Context("without installers", func() {
+		BeforeEach(func() {
+			StartGenerator()
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
+		It("writes the scripts and certificates into the archive", func() {
+			files := ReadZip()
+			for _, name := range []string{
+				"install.bat", "install.ps1",
+				"consul_ca.crt", "consul_agent.crt", "consul_agent.key", "consul_encrypt.key",
+				"bbs_ca.crt", "bbs_client.crt", "bbs_client.key",
+				"contents.json",
+			} {
+				Expect(files).To(HaveKey(name))
+			}
+			Expect(string(files["bbs_client.crt"])).To(Equal("BBS_CLIENT_CERT"))
+		})
+
+		It("lists every file with its purpose and checksum", func() {
+			files := ReadZip()
+			contents := ReadContents(files)
+			Expect(contents.Files).To(HaveLen(len(files) - 1))
+
+			for _, file := range contents.Files {
+				Expect(files).To(HaveKey(file.File))
+				Expect(file.Purpose).NotTo(BeEmpty())
+
+				sum := sha256.Sum256(files[file.File])
+				Expect(file.SHA256).To(Equal(hex.EncodeToString(sum[:])))
+			}
+		})
+	})
+
+	Context("with an installer directory", func() {
+		var msiDir string
+
+		BeforeEach(func() {
+			msiDir = path.Join(tmpDir, "msis")
+			Expect(os.Mkdir(msiDir, 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(msiDir, "DiegoWindows.msi"), []byte("DIEGO"), 0644)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(msiDir, "GardenWindows.msi"), []byte("GARDEN"), 0644)).To(Succeed())
+		})
+
+		It("includes the installers", func() {
+			StartGenerator("-msiDir", msiDir)
+			Eventually(session).Should(gexec.Exit(0))
+
+			files := ReadZip()
+			Expect(string(files["DiegoWindows.msi"])).To(Equal("DIEGO"))
+			Expect(string(files["GardenWindows.msi"])).To(Equal("GARDEN"))
+
+			purposes := map[string]string{}
+			for _, file := range ReadContents(files).Files {
+				purposes[file.File] = file.Purpose
+			}
+			Expect(purposes["DiegoWindows.msi"]).To(Equal("Diego installer"))
+		})
+
+		It("omits GardenWindows.msi on stacks that do not install it", func() {
+			StartGenerator("-msiDir", msiDir, "-stack", "windows2016")
+			Eventually(session).Should(gexec.Exit(0))
+
+			files := ReadZip()
+			Expect(files).To(HaveKey("DiegoWindows.msi"))
+			Expect(files).NotTo(HaveKey("GardenWindows.msi"))
+		})
+
+		It("fails when an installer is missing", func() {
+			Expect(os.Remove(path.Join(msiDir, "DiegoWindows.msi"))).To(Succeed())
+			StartGenerator("-msiDir", msiDir)
+			Eventually(session).Should(gexec.Exit(1))
+
+			_, err := os.Stat(zipFile)
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,77 @@
+package integration_test
+
+import (
+	"os"
+	"path"
+
+	"models"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("Redundancy zones", func() {
+	var outputDir string
+	var session *gexec.Session
+
+	UseTempDir(&outputDir)
+
+	StartGenerator := func(manifest string, extraArgs ...string) {
+		args := append([]string{
+			"-manifest", manifest,
+			"-outputDir", outputDir,
+			"-skipCertValidation",
+			"-machineIp", "127.0.0.1",
+		}, extraArgs...)
+		session = StartGeneratorAsAdmin(args...)
+		Eventually(session).Should(gexec.Exit(0))
+	}
+
+	ExpectedScript := func(zone string) string {
+		return ExpectedContent(models.InstallerArguments{
+			ConsulRequireSSL: true,
+			SyslogHostIP:     "logs2.test.com",
+			BbsRequireSsl:    true,
+			Username:         "admin",
+			Password:         `"""password"""`,
+			Zone:             zone,
+		})
+	}
+
+	Context("when the manifest has a single zone", func() {
+		It("uses the zone of the rep job", func() {
+			StartGenerator("syslog_manifest.yml")
+			Expect(ReadOutputFile(outputDir, "install.bat")).To(Equal(ExpectedScript("zone1")))
+		})
+
+		It("uses the zone given on the command line", func() {
+			StartGenerator("syslog_manifest.yml", "-zone", "windows-z2")
+			Expect(ReadOutputFile(outputDir, "install.bat")).To(Equal(ExpectedScript("windows-z2")))
+		})
+	})
+
+	Context("when the manifest has rep jobs in several zones", func() {
+		It("generates the scripts of every zone into a subdirectory", func() {
+			StartGenerator("multi_zone_manifest.yml")
+
+			for _, zone := range []string{"z1", "z2", "z3"} {
+				Expect(ReadOutputFile(path.Join(outputDir, zone), "install.bat")).To(Equal(ExpectedScript(zone)))
+				Expect(ReadOutputFile(path.Join(outputDir, zone), "consul_ca.crt")).To(Equal("CONSUL_CA_CERT"))
+				Eventually(session.Out).Should(gbytes.Say("Generated scripts for zone " + zone))
+			}
+
+			_, err := os.Stat(path.Join(outputDir, "install.bat"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+
+		It("only generates the zone given on the command line", func() {
+			StartGenerator("multi_zone_manifest.yml", "-zone", "z2")
+
+			Expect(ReadOutputFile(outputDir, "install.bat")).To(Equal(ExpectedScript("z2")))
+			_, err := os.Stat(path.Join(outputDir, "z1"))
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+})
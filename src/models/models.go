@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Release struct {
 	Name    string `json:"name"`
 	Version string `json:"version"`
@@ -15,18 +17,23 @@ type ShowDeployment struct {
 }
 
 type InstallerArguments struct {
-	ConsulRequireSSL bool
-	ConsulIPs        string
-	EtcdCluster      string
-	Zone             string
-	SharedSecret     string
-	Username         string
-	Password         string
-	SyslogHostIP     string
-	SyslogPort       string
-	BbsRequireSsl    bool
-	MachineIp        string
-	MetronPreferTLS  bool
+	ConsulRequireSSL     bool
+	ConsulIPs            string
+	EtcdCluster          string
+	EtcdRequireSSL       bool
+	Zone                 string
+	SharedSecret         string
+	Username             string
+	Password             string
+	SyslogHostIP         string
+	SyslogPort           string
+	BbsRequireSsl        bool
+	MachineIp            string
+	MetronPreferTLS      bool
+	Stack                string
+	InstallGardenWindows bool
+	SecretsFile          bool
+	ContainersDir        string
 }
 
 type ConsulProperties struct {
@@ -58,7 +65,10 @@ type DiegoProperties struct {
 
 type LoggregatorProperties struct {
 	Etcd struct {
-		Machines []string `yaml:"machines"`
+		Machines   []string `yaml:"machines"`
+		RequireSSL *bool    `yaml:"require_ssl"`
+		Port       int      `yaml:"port"`
+		CACert     string   `yaml:"ca_cert"`
 	} `yaml:"etcd"`
 	Tls struct {
 		CA string `yaml:"ca"`
@@ -75,6 +85,10 @@ type MetronAgent struct {
 		Cert string `yaml:"cert"`
 		Key  string `yaml:"key"`
 	} `yaml:"tls_client"`
+	Etcd struct {
+		ClientCert string `yaml:"client_cert"`
+		ClientKey  string `yaml:"client_key"`
+	} `yaml:"etcd"`
 }
 
 type SyslogProperties struct {
@@ -83,12 +97,13 @@ type SyslogProperties struct {
 }
 
 type Properties struct {
-	Consul         *ConsulProperties      `yaml:"consul"`
-	Diego          *DiegoProperties       `yaml:"diego"`
-	Loggregator    *LoggregatorProperties `yaml:"loggregator"`
-	MetronEndpoint *MetronEndpoint        `yaml:"metron_endpoint"`
-	MetronAgent    *MetronAgent           `yaml:"metron_agent"`
-	Syslog         *SyslogProperties      `yaml:"syslog_daemon_config"`
+	Consul          *ConsulProperties      `yaml:"consul"`
+	Diego           *DiegoProperties       `yaml:"diego"`
+	Loggregator     *LoggregatorProperties `yaml:"loggregator"`
+	MetronEndpoint  *MetronEndpoint        `yaml:"metron_endpoint"`
+	MetronAgent     *MetronAgent           `yaml:"metron_agent"`
+	Syslog          *SyslogProperties      `yaml:"syslog_daemon_config"`
+	SyslogForwarder *SyslogProperties      `yaml:"syslog"`
 }
 
 type Job struct {
@@ -96,7 +111,85 @@ type Job struct {
 	Properties *Properties `yaml:"properties"`
 }
 
-type Manifest struct {
-	Jobs       []Job       `yaml:"jobs"`
+type InstanceGroupJob struct {
+	Name       string      `yaml:"name"`
+	Release    string      `yaml:"release"`
 	Properties *Properties `yaml:"properties"`
 }
+
+type InstanceGroup struct {
+	Name string             `yaml:"name"`
+	Jobs []InstanceGroupJob `yaml:"jobs"`
+}
+
+type Manifest struct {
+	Name           string          `yaml:"name"`
+	Jobs           []Job           `yaml:"jobs"`
+	InstanceGroups []InstanceGroup `yaml:"instance_groups"`
+	Properties     *Properties     `yaml:"properties"`
+}
+
+type DirectorInfo struct {
+	Name               string `json:"name"`
+	UserAuthentication struct {
+		Type    string `json:"type"`
+		Options struct {
+			URL string `json:"url"`
+		} `json:"options"`
+	} `json:"user_authentication"`
+}
+
+type UAAToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+type CredHubInfo struct {
+	AuthServer struct {
+		URL string `json:"url"`
+	} `json:"auth-server"`
+}
+
+type CredHubCredential struct {
+	Name  string      `json:"name"`
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+type CredHubData struct {
+	Data []CredHubCredential `json:"data"`
+}
+
+type OpsManagerProduct struct {
+	InstallationName string `json:"installation_name"`
+	GUID             string `json:"guid"`
+	Type             string `json:"type"`
+}
+
+type OpsManagerProperties struct {
+	Properties map[string]struct {
+		Value interface{} `json:"value"`
+	} `json:"properties"`
+}
+
+type BundleFile struct {
+	File    string `json:"file"`
+	Purpose string `json:"purpose"`
+	Secret  bool   `json:"secret"`
+	SHA256  string `json:"sha256"`
+}
+
+type BundleContents struct {
+	Files []BundleFile `json:"files"`
+}
+
+type CertificateInfo struct {
+	Property        string    `json:"property"`
+	Subject         string    `json:"subject"`
+	SANs            []string  `json:"sans"`
+	Issuer          string    `json:"issuer"`
+	NotAfter        time.Time `json:"not_after"`
+	DaysUntilExpiry int       `json:"days_until_expiry"`
+}